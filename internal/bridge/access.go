@@ -0,0 +1,118 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+)
+
+// accessSet 访问名单, 用于快速查找
+type accessSet struct {
+	users       map[string]struct{}
+	departments map[string]struct{}
+	chats       map[string]struct{}
+}
+
+func newAccessSet(list config.AccessList) accessSet {
+	return accessSet{
+		users:       toSet(list.Users),
+		departments: toSet(list.Departments),
+		chats:       toSet(list.Chats),
+	}
+}
+
+func (s accessSet) empty() bool {
+	return len(s.users) == 0 && len(s.departments) == 0 && len(s.chats) == 0
+}
+
+// match 返回消息命中的名单项, 未命中时返回空字符串
+func (s accessSet) match(msg *feishu.InboundMessage) string {
+	for _, id := range []string{msg.SenderID, msg.SenderUnionID} {
+		if _, ok := s.users[id]; ok && id != "" {
+			return "user=" + id
+		}
+	}
+	for _, dept := range msg.SenderDepartments {
+		if _, ok := s.departments[dept]; ok {
+			return "department=" + dept
+		}
+	}
+	if _, ok := s.chats[msg.ChatID]; ok {
+		return "chat=" + msg.ChatID
+	}
+	return ""
+}
+
+// accessControl 按允许和拒绝名单判断发送者和会话能否使用机器人
+type accessControl struct {
+	allow accessSet
+	deny  accessSet
+}
+
+func newAccessControl(policy config.AccessPolicy) *accessControl {
+	return &accessControl{
+		allow: newAccessSet(policy.Allow),
+		deny:  newAccessSet(policy.Deny),
+	}
+}
+
+// check 判断消息是否允许处理, 拒绝时返回原因
+// 拒绝名单优先, 设置了部门拒绝名单而发送者部门查询失败时同样拒绝;
+// 允许名单不为空时, 发送者、所属部门或会话须命中其中一项
+func (a *accessControl) check(msg *feishu.InboundMessage) (bool, string) {
+	if hit := a.deny.match(msg); hit != "" {
+		return false, fmt.Sprintf("命中拒绝名单 %s", hit)
+	}
+	if msg.SenderLookupFailed && len(a.deny.departments) > 0 {
+		return false, "查询发送者部门失败, 无法检查部门拒绝名单"
+	}
+	if !a.allow.empty() && a.allow.match(msg) == "" {
+		return false, "不在允许名单中"
+	}
+	return true, ""
+}
+
+// checkAccess 访问控制处理器, 在飞书客户端下载附件之前调用
+// 不允许的用户和会话收到拒绝提示, 消息不转发给 agent
+func (b *Bridge) checkAccess(_ context.Context, msg *feishu.InboundMessage) (bool, string) {
+	ok, reason := b.access.check(msg)
+	if !ok {
+		msgLogger(msg, b.sessionKey(msg)).Warn("拒绝访问",
+			"sender_id", msg.SenderID, "sender_name", msg.SenderName, "reason", reason)
+	}
+	return ok, b.cfg.Access.DeniedText
+}
+
+// 按部门控制访问所需的通讯录权限
+var contactScopes = []string{"contact:user.base:readonly", "contact:user.department:readonly"}
+
+// checkContactScopes 设置了部门名单时检查通讯录权限
+// 缺少权限时部门查询失败或为空: 部门允许名单无法命中, 部门拒绝名单会拒绝所有查询失败的发送者
+func (b *Bridge) checkContactScopes(ctx context.Context) {
+	if len(b.cfg.Access.Allow.Departments) == 0 && len(b.cfg.Access.Deny.Departments) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	missing, err := b.feishuCli.MissingScopes(ctx, contactScopes...)
+	if err != nil {
+		slog.Warn("无法检查通讯录权限, 按部门的访问控制可能不生效", "scopes", strings.Join(contactScopes, ","), "error", err)
+		return
+	}
+	if len(missing) > 0 {
+		slog.Warn("缺少通讯录权限, 按部门的访问控制不生效", "missing", strings.Join(missing, ","))
+	}
+}
+
+func toSet(items []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		set[item] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,83 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+)
+
+func TestAccessCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy config.AccessPolicy
+		msg    feishu.InboundMessage
+		want   bool
+	}{
+		{
+			name: "no lists",
+			msg:  feishu.InboundMessage{SenderID: "ou_a", ChatID: "oc_a"},
+			want: true,
+		},
+		{
+			name:   "denied user",
+			policy: config.AccessPolicy{Deny: config.AccessList{Users: []string{"ou_a"}}},
+			msg:    feishu.InboundMessage{SenderID: "ou_a"},
+			want:   false,
+		},
+		{
+			name:   "denied department",
+			policy: config.AccessPolicy{Deny: config.AccessList{Departments: []string{"od_x"}}},
+			msg:    feishu.InboundMessage{SenderID: "ou_a", SenderDepartments: []string{"od_y", "od_x"}},
+			want:   false,
+		},
+		{
+			name:   "other department",
+			policy: config.AccessPolicy{Deny: config.AccessList{Departments: []string{"od_x"}}},
+			msg:    feishu.InboundMessage{SenderID: "ou_a", SenderDepartments: []string{"od_y"}},
+			want:   true,
+		},
+		{
+			// 部门未知时无法确认发送者不在拒绝名单中
+			name:   "department lookup failed with deny list",
+			policy: config.AccessPolicy{Deny: config.AccessList{Departments: []string{"od_x"}}},
+			msg:    feishu.InboundMessage{SenderID: "ou_a", SenderLookupFailed: true},
+			want:   false,
+		},
+		{
+			name:   "department lookup failed without deny list",
+			policy: config.AccessPolicy{Deny: config.AccessList{Users: []string{"ou_b"}}},
+			msg:    feishu.InboundMessage{SenderID: "ou_a", SenderLookupFailed: true},
+			want:   true,
+		},
+		{
+			name:   "department lookup failed but chat allowed",
+			policy: config.AccessPolicy{Allow: config.AccessList{Departments: []string{"od_x"}, Chats: []string{"oc_a"}}},
+			msg:    feishu.InboundMessage{SenderID: "ou_a", ChatID: "oc_a", SenderLookupFailed: true},
+			want:   true,
+		},
+		{
+			name:   "not in allow list",
+			policy: config.AccessPolicy{Allow: config.AccessList{Chats: []string{"oc_a"}}},
+			msg:    feishu.InboundMessage{SenderID: "ou_a", ChatID: "oc_b"},
+			want:   false,
+		},
+		{
+			name: "deny wins over allow",
+			policy: config.AccessPolicy{
+				Allow: config.AccessList{Chats: []string{"oc_a"}},
+				Deny:  config.AccessList{Users: []string{"on_a"}},
+			},
+			msg:  feishu.InboundMessage{SenderID: "ou_a", SenderUnionID: "on_a", ChatID: "oc_a"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := newAccessControl(tt.policy).check(&tt.msg)
+			if got != tt.want {
+				t.Errorf("check() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
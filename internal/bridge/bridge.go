@@ -2,88 +2,284 @@ package bridge
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/vogo/moltbot-feishu/internal/config"
 	"github.com/vogo/moltbot-feishu/internal/feishu"
+	"github.com/vogo/moltbot-feishu/internal/metrics"
 	"github.com/vogo/moltbot-feishu/internal/moltbot"
+	"github.com/vogo/moltbot-feishu/internal/ratelimit"
+	"github.com/vogo/moltbot-feishu/internal/tracing"
 )
 
+var tracer = tracing.Tracer("bridge")
+
 type Bridge struct {
 	cfg        *config.Config
 	feishuCli  *feishu.Client
 	moltbotCli *moltbot.Client
+	startedAt  time.Time
+	queue      *dispatcher
+	access     *accessControl
+	limiter    *ratelimit.Limiter
+
+	// runs 按会话键记录进行中的运行, chatAgents 记录通过 /agent 切换的 Agent
+	runs       map[string]*activeRun
+	chatAgents map[string]string
+	mu         sync.Mutex
 }
 
-func New(cfg *config.Config) *Bridge {
-	feishuCli := feishu.NewClient(cfg.FeishuAppID, cfg.FeishuAppSecret)
+func New(cfg *config.Config) (*Bridge, error) {
+	feishuCli := feishu.NewClient(cfg.FeishuAppID, cfg.FeishuAppSecret, feishu.Options{
+		EventMode:         cfg.EventMode,
+		VerificationToken: cfg.FeishuVerificationToken,
+		EncryptKey:        cfg.FeishuEncryptKey,
+		ReplyTo:           cfg.ReplyTo,
+		RenderMode:        cfg.RenderMode,
+		ChatRenderModes:   cfg.ChatRenderModes,
+		MaxFileBytes:      cfg.MaxFileBytes,
+		AllowedFileTypes:  cfg.AllowedFileTypes,
+		GroupPolicy:       toGroupPolicy(cfg.GroupPolicy),
+		ChatGroupPolicies: toGroupPolicies(cfg.ChatGroupPolicies),
+		RedactLogs:        cfg.LogRedact,
+	})
 	moltbotCli := moltbot.NewClient(cfg.GatewayPort, cfg.GatewayToken, cfg.MoltbotAgentID)
+	limiter, err := newLimiter(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Bridge{
+	b := &Bridge{
 		cfg:        cfg,
 		feishuCli:  feishuCli,
 		moltbotCli: moltbotCli,
+		startedAt:  time.Now(),
+		access:     newAccessControl(cfg.Access),
+		limiter:    limiter,
+		runs:       make(map[string]*activeRun),
+		chatAgents: make(map[string]string),
 	}
+	b.queue = newDispatcher(cfg.MaxConcurrency, cfg.QueueSize, cfg.QueueOverflow,
+		time.Duration(cfg.DebounceMs)*time.Millisecond, b.processMessage)
+	return b, nil
 }
 
 func (b *Bridge) Run(ctx context.Context) error {
 	// 连接 Moltbot Gateway (10秒超时)
-	log.Printf("正在连接 Moltbot Gateway (ws://127.0.0.1:%d)...", b.cfg.GatewayPort)
+	slog.Info("正在连接 Moltbot Gateway", "port", b.cfg.GatewayPort)
 	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	err := b.moltbotCli.Connect(connectCtx)
 	cancel()
 	if err != nil {
 		return fmt.Errorf("连接 Moltbot Gateway 失败: %w", err)
 	}
-	log.Println("已连接 Moltbot Gateway")
+	slog.Info("已连接 Moltbot Gateway")
 
 	// 确保退出时关闭连接
 	defer b.Close()
 
 	// 设置消息处理器
 	b.feishuCli.SetHandler(b.handleMessage)
+	b.feishuCli.SetAccessHandler(b.checkAccess)
+	b.feishuCli.SetCancelHandler(b.cancelByMessage)
+	b.checkContactScopes(ctx)
 
 	// 启动飞书客户端
-	log.Println("正在启动飞书桥接...")
+	slog.Info("正在启动飞书桥接")
 	return b.feishuCli.Start(ctx)
 }
 
 func (b *Bridge) Close() {
-	log.Println("正在关闭连接...")
+	slog.Info("正在关闭连接")
 	b.feishuCli.Close()
 	b.moltbotCli.Close()
+	if err := b.limiter.Close(); err != nil {
+		slog.Warn("保存限流计数失败", "error", err)
+	}
 }
 
-func (b *Bridge) handleMessage(ctx context.Context, chatID, text string, reply func(string) error) error {
-	sessionKey := fmt.Sprintf("feishu:%s", chatID)
+func (b *Bridge) handleMessage(ctx context.Context, msg *feishu.InboundMessage, reply feishu.ReplyFunc) error {
+	sessionKey := b.sessionKey(msg)
+	logger := msgLogger(msg, sessionKey)
+
+	logger.Info("收到消息", "sender_id", msg.SenderID, "text", msg.Text, "attachments", len(msg.Attachments))
+
+	// 聊天命令不排队, 以便 /stop 等命令立即生效
+	if b.handleCommand(ctx, msg, sessionKey, reply) {
+		return nil
+	}
+
+	// 限流: 超过用户或会话的频率、每日配额时提示何时可以再试
+	if notice, ok := b.checkRateLimit(msg); !ok {
+		logger.Warn("触发限流", "sender_id", msg.SenderID, "notice", notice)
+		if err := reply(notice, true); err != nil {
+			logger.Warn("发送回复失败", "error", err)
+		}
+		return nil
+	}
 
-	log.Printf("收到消息: chatID=%s, text=%s", chatID, truncate(text, 50))
+	// 同一会话的消息排队依次处理
+	b.queue.submit(sessionKey, &job{ctx: ctx, msg: msg, reply: reply})
+	return nil
+}
 
-	// 发送消息到 Moltbot
-	runID, deltaCh, errCh, err := b.moltbotCli.SendMessage(ctx, sessionKey, text)
+// processMessage 处理一条排队消息, 出错时回复错误信息
+func (b *Bridge) processMessage(ctx context.Context, sessionKey string, msg *feishu.InboundMessage, reply feishu.ReplyFunc) {
+	if err := b.runAgent(ctx, sessionKey, msg, reply); err != nil {
+		logger := msgLogger(msg, sessionKey)
+		logger.Error("处理消息失败", "error", err)
+		if replyErr := reply(fmt.Sprintf("处理消息时发生错误: %v", err), true); replyErr != nil {
+			logger.Warn("发送回复失败", "error", replyErr)
+		}
+	}
+}
+
+// runAgent 将消息发送给 agent, 并把回复流式转发到飞书
+func (b *Bridge) runAgent(ctx context.Context, sessionKey string, msg *feishu.InboundMessage, reply feishu.ReplyFunc) error {
+	chatID := msg.ChatID
+	logger := msgLogger(msg, sessionKey)
+	agentID := b.agentFor(chatID)
+
+	ctx, span := tracer.Start(ctx, "agent.run", trace.WithAttributes(
+		attribute.String("session_key", sessionKey),
+		attribute.String("agent_id", agentID),
+	))
+	defer span.End()
+
+	// 处理结束时取消运行订阅
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 思考中提示: 超过阈值仍未收到第一个 delta 时显示, 之后的回复会原地替换它
+	var thinkingC <-chan time.Time
+	if b.cfg.ThinkingThresholdMs > 0 {
+		thinkingTimer := time.NewTimer(time.Duration(b.cfg.ThinkingThresholdMs) * time.Millisecond)
+		defer thinkingTimer.Stop()
+		thinkingC = thinkingTimer.C
+	}
+	thinking := false
+
+	// 记录运行结果和耗时
+	startedAt := time.Now()
+	metrics.AgentRunsStarted.Inc()
+	finish := func(result string) {
+		metrics.AgentRunsFinished.WithLabelValues(result).Inc()
+		metrics.RunDurationSeconds.Observe(time.Since(startedAt).Seconds())
+		span.SetAttributes(attribute.String("result", result))
+		if result == metrics.RunError || result == metrics.RunTimeout {
+			span.SetStatus(codes.Error, result)
+		}
+	}
+
+	// 发送前登记运行, 以便 /stop、停止按钮或撤回消息在 Gateway 重连等待期间同样生效
+	run := &activeRun{messageID: msg.MessageID, startedAt: startedAt, stop: make(chan struct{})}
+	b.trackRun(sessionKey, run)
+	defer b.untrackRun(sessionKey, run)
+
+	// 发送消息到 Moltbot, 发起期间被停止时取消请求
+	reqCtx, cancelReq := context.WithCancel(ctx)
+	defer cancelReq()
+	requested := make(chan struct{})
+	go func() {
+		select {
+		case <-run.stop:
+			cancelReq()
+		case <-requested:
+		}
+	}()
+	reqCtx, reqSpan := tracer.Start(reqCtx, "gateway.agent_request", trace.WithSpanKind(trace.SpanKindClient))
+	runID, deltaCh, errCh, err := b.moltbotCli.SendMessage(reqCtx, moltbot.AgentParams{
+		Message:     envelope(msg),
+		AgentID:     agentID,
+		SessionKey:  sessionKey,
+		Attachments: toMoltbotAttachments(msg.Attachments),
+	})
+	tracing.End(reqSpan, err)
+	close(requested)
+
+	// 请求只会因停止而被取消, 此时即使已发起运行也立即中止
+	select {
+	case <-run.stop:
+		logger.Info("用户停止回复")
+		finish(metrics.RunStopped)
+		if err == nil {
+			if err := b.moltbotCli.AbortRun(ctx, sessionKey, runID); err != nil {
+				logger.Warn("中止运行失败", "run_id", runID, "error", err)
+			}
+		}
+		if err := reply("（已停止）", true); err != nil {
+			logger.Warn("发送回复失败", "error", err)
+		}
+		return nil
+	default:
+	}
 	if err != nil {
+		finish(metrics.RunError)
 		return fmt.Errorf("发送到 Moltbot 失败: %w", err)
 	}
 
-	log.Printf("Moltbot 开始处理: runID=%s", runID)
+	logger = logger.With("run_id", runID)
+	logger.Info("Moltbot 开始处理")
+	span.SetAttributes(attribute.String("run_id", runID))
 
 	var accumulated strings.Builder
+	var gotDelta bool
 	globalTimeout := time.After(5 * time.Minute)
-	idleTimer := time.NewTimer(2 * time.Second)
-	idleTimer.Stop() // 初始停止，收到第一个 delta 后启动
 
-	// 发送累积的消息
-	sendAccumulated := func() {
+	// 流式模式下按最小间隔节流更新, 非流式模式只在结束时发送一次
+	// 文本消息的编辑次数有限, 纯文本渲染的会话不做流式更新
+	streaming := b.cfg.ReplyMode == config.ReplyModeStream &&
+		b.feishuCli.RenderModeFor(chatID) == feishu.RenderModeCard
+	interval := time.Duration(b.cfg.StreamIntervalMs) * time.Millisecond
+	var lastFlush time.Time
+	var sent string
+	var flushTimer *time.Timer
+	var flushC <-chan time.Time
+	stopFlushTimer := func() {
+		if flushTimer != nil {
+			flushTimer.Stop()
+			flushTimer, flushC = nil, nil
+		}
+	}
+	defer stopFlushTimer()
+
+	// 发送截至目前的完整回复, 内容未变化时跳过
+	// final 为 true 时即使内容未变化也发送, 以便移除卡片上的停止按钮
+	flush := func(final bool) {
+		stopFlushTimer()
 		content := strings.TrimSpace(accumulated.String())
-		if content != "" {
-			if err := reply(content); err != nil {
-				log.Printf("发送回复失败: %v", err)
-			}
-			accumulated.Reset()
+		if content == "" || (content == sent && !final) {
+			return
+		}
+		if err := reply(content, final); err != nil {
+			logger.Warn("发送回复失败", "error", err)
+			return
+		}
+		sent = content
+		lastFlush = time.Now()
+		thinking = false
+	}
+
+	// 将错误信息写入回复: 替换思考中提示, 或附在已发送的内容之后
+	fail := func(err error) error {
+		logger.Error("处理消息失败", "error", err)
+		note := fmt.Sprintf("处理消息时发生错误: %v", err)
+		if sent != "" {
+			note = sent + "\n\n" + note
 		}
+		if replyErr := reply(note, true); replyErr != nil {
+			logger.Warn("发送回复失败", "error", replyErr)
+		}
+		return nil
 	}
 
 	for {
@@ -91,40 +287,119 @@ func (b *Bridge) handleMessage(ctx context.Context, chatID, text string, reply f
 		case delta, ok := <-deltaCh:
 			if !ok {
 				// 流结束，发送剩余内容
-				idleTimer.Stop()
-				sendAccumulated()
-				log.Printf("Moltbot 回复完成")
+				flush(true)
+				if thinking {
+					if err := reply("（无回复内容）", true); err != nil {
+						logger.Warn("发送回复失败", "error", err)
+					}
+				}
+				logger.Info("Moltbot 回复完成", "duration", time.Since(startedAt).Round(time.Millisecond))
+				finish(metrics.RunCompleted)
 				return nil
 			}
-			// 累积内容
+			if !gotDelta {
+				gotDelta = true
+				metrics.FirstDeltaSeconds.Observe(time.Since(startedAt).Seconds())
+				span.AddEvent("first_delta")
+			}
+			thinkingC = nil
 			accumulated.WriteString(delta)
-			// 重置 5 秒定时器
-			idleTimer.Stop()
-			idleTimer = time.NewTimer(2 * time.Second)
+			if !streaming || flushTimer != nil {
+				continue
+			}
+			if wait := interval - time.Since(lastFlush); wait > 0 {
+				flushTimer = time.NewTimer(wait)
+				flushC = flushTimer.C
+			} else {
+				flush(false)
+			}
 
-		case <-idleTimer.C:
-			// 5 秒没有新 delta，发送累积的内容
-			sendAccumulated()
+		case <-flushC:
+			flushTimer, flushC = nil, nil
+			flush(false)
+
+		case <-thinkingC:
+			thinkingC = nil
+			if sent == "" {
+				if err := reply(b.cfg.ThinkingText, false); err != nil {
+					logger.Warn("发送思考中提示失败", "error", err)
+				} else {
+					thinking = true
+				}
+			}
 
 		case err := <-errCh:
-			idleTimer.Stop()
-			return err
+			span.RecordError(err)
+			flush(true)
+			finish(metrics.RunError)
+			return fail(err)
 
 		case <-globalTimeout:
-			idleTimer.Stop()
-			sendAccumulated()
-			return fmt.Errorf("等待 Moltbot 响应超时")
+			flush(true)
+			finish(metrics.RunTimeout)
+			if err := b.moltbotCli.AbortRun(ctx, sessionKey, runID); err != nil {
+				logger.Warn("中止运行失败", "error", err)
+			}
+			return fail(fmt.Errorf("等待 Moltbot 响应超时"))
+
+		case <-run.stop:
+			logger.Info("用户停止回复")
+			finish(metrics.RunStopped)
+			if err := b.moltbotCli.AbortRun(ctx, sessionKey, runID); err != nil {
+				logger.Warn("中止运行失败", "error", err)
+			}
+			note := "（已停止）"
+			if content := strings.TrimSpace(accumulated.String()); content != "" {
+				note = content + "\n\n" + note
+			}
+			if err := reply(note, true); err != nil {
+				logger.Warn("发送回复失败", "error", err)
+			}
+			return nil
 
 		case <-ctx.Done():
-			idleTimer.Stop()
+			finish(metrics.RunCanceled)
 			return ctx.Err()
 		}
 	}
 }
 
-func truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
+// toGroupPolicy 将配置中的群聊响应策略转换为飞书客户端策略
+func toGroupPolicy(p config.GroupPolicy) feishu.GroupPolicy {
+	return feishu.GroupPolicy{Mode: p.Mode, Keywords: p.Keywords, Patterns: p.Regexps}
+}
+
+func toGroupPolicies(policies map[string]config.GroupPolicy) map[string]feishu.GroupPolicy {
+	result := make(map[string]feishu.GroupPolicy, len(policies))
+	for chatID, p := range policies {
+		result[chatID] = toGroupPolicy(p)
 	}
-	return s[:maxLen] + "..."
+	return result
+}
+
+// toMoltbotAttachments 将飞书附件转换为 agent 请求附件
+func toMoltbotAttachments(attachments []feishu.Attachment) []moltbot.Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+	result := make([]moltbot.Attachment, 0, len(attachments))
+	for _, att := range attachments {
+		ma := moltbot.Attachment{
+			Type:     att.Type,
+			MimeType: att.MimeType,
+			FileName: att.FileName,
+		}
+		if att.Text != "" {
+			ma.Text = att.Text
+		} else {
+			ma.Content = base64.StdEncoding.EncodeToString(att.Data)
+		}
+		result = append(result, ma)
+	}
+	return result
+}
+
+// msgLogger 返回带会话和消息字段的日志记录器
+func msgLogger(msg *feishu.InboundMessage, sessionKey string) *slog.Logger {
+	return slog.With("chat_id", msg.ChatID, "session_key", sessionKey, "message_id", msg.MessageID)
 }
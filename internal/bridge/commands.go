@@ -0,0 +1,197 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+)
+
+const helpText = `可用命令:
+/reset - 重置当前会话, 开始新的对话
+/agent [id] - 查看或切换本会话使用的 Agent
+/stop - 停止正在进行的回复
+/status - 查看桥接状态
+/help - 显示本帮助`
+
+// command 聊天命令处理函数, args 为命令名之后的参数
+type command func(ctx context.Context, msg *feishu.InboundMessage, sessionKey string, args []string) string
+
+// activeRun 进行中的 agent 运行
+type activeRun struct {
+	messageID string // 触发运行的飞书消息
+	startedAt time.Time
+	// stop 在用户要求停止时关闭, stopped 由 Bridge.mu 保护
+	stop    chan struct{}
+	stopped bool
+}
+
+func (b *Bridge) commands() map[string]command {
+	return map[string]command{
+		"/reset":  b.cmdReset,
+		"/help":   b.cmdHelp,
+		"/agent":  b.cmdAgent,
+		"/stop":   b.cmdStop,
+		"/status": b.cmdStatus,
+	}
+}
+
+// handleCommand 处理以 / 开头的聊天命令, 未知命令返回 false 交给 agent 处理
+func (b *Bridge) handleCommand(ctx context.Context, msg *feishu.InboundMessage, sessionKey string, reply feishu.ReplyFunc) bool {
+	fields := strings.Fields(msg.Text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return false
+	}
+	cmd, ok := b.commands()[strings.ToLower(fields[0])]
+	if !ok {
+		return false
+	}
+
+	logger := msgLogger(msg, sessionKey)
+	logger.Info("执行命令", "command", fields[0])
+	if err := reply(cmd(ctx, msg, sessionKey, fields[1:]), true); err != nil {
+		logger.Warn("发送命令回复失败", "error", err)
+	}
+	return true
+}
+
+func (b *Bridge) cmdHelp(_ context.Context, _ *feishu.InboundMessage, _ string, _ []string) string {
+	return helpText
+}
+
+func (b *Bridge) cmdReset(ctx context.Context, _ *feishu.InboundMessage, sessionKey string, _ []string) string {
+	b.stopRun(sessionKey)
+	if err := b.moltbotCli.ResetSession(ctx, sessionKey); err != nil {
+		slog.Warn("重置会话失败", "session_key", sessionKey, "error", err)
+		return fmt.Sprintf("重置会话失败: %v", err)
+	}
+	return "会话已重置, 可以开始新的对话了"
+}
+
+// cmdAgent 查看或切换会话使用的 Agent
+// 只能切换到 MoltbotAgents 中且 Gateway 上存在的 Agent; 设置了 AgentAdmins 时只有其中的用户可以切换
+func (b *Bridge) cmdAgent(ctx context.Context, msg *feishu.InboundMessage, sessionKey string, args []string) string {
+	if len(args) == 0 {
+		return fmt.Sprintf("当前 Agent: %s", b.agentFor(msg.ChatID))
+	}
+
+	agentID := args[0]
+	allowed := append([]string{b.moltbotCli.AgentID()}, b.cfg.MoltbotAgents...)
+	switch {
+	case len(b.cfg.MoltbotAgents) == 0:
+		return "未配置可切换的 Agent, 不能切换"
+	case len(b.cfg.AgentAdmins) > 0 && !slices.Contains(b.cfg.AgentAdmins, msg.SenderID):
+		msgLogger(msg, sessionKey).Warn("无权切换 Agent", "sender_id", msg.SenderID, "agent_id", agentID)
+		return "只有管理员可以切换 Agent"
+	case !slices.Contains(allowed, agentID):
+		return fmt.Sprintf("不能切换到 Agent %s, 可选: %s", agentID, strings.Join(allowed, ", "))
+	}
+
+	// 确认 Gateway 上存在该 Agent, 查询失败时不切换
+	agents, err := b.moltbotCli.ListAgents(ctx)
+	if err != nil {
+		msgLogger(msg, sessionKey).Warn("查询 Agent 列表失败", "error", err)
+		return fmt.Sprintf("无法确认 Agent 是否存在: %v", err)
+	}
+	if !slices.Contains(agents, agentID) {
+		return fmt.Sprintf("Gateway 上不存在 Agent %s", agentID)
+	}
+
+	msgLogger(msg, sessionKey).Info("切换 Agent", "sender_id", msg.SenderID, "agent_id", agentID)
+	b.mu.Lock()
+	if agentID == b.moltbotCli.AgentID() {
+		delete(b.chatAgents, msg.ChatID)
+	} else {
+		b.chatAgents[msg.ChatID] = agentID
+	}
+	b.mu.Unlock()
+	return fmt.Sprintf("本会话已切换到 Agent: %s", agentID)
+}
+
+func (b *Bridge) cmdStop(_ context.Context, _ *feishu.InboundMessage, sessionKey string, _ []string) string {
+	if !b.stopRun(sessionKey) {
+		return "当前没有正在进行的回复"
+	}
+	return "已停止当前回复"
+}
+
+func (b *Bridge) cmdStatus(_ context.Context, msg *feishu.InboundMessage, sessionKey string, _ []string) string {
+	gateway := "已连接"
+	if !b.moltbotCli.Connected() {
+		gateway = "已断开 (重连中)"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Gateway: %s\n", gateway)
+	fmt.Fprintf(&sb, "Agent: %s\n", b.agentFor(msg.ChatID))
+	fmt.Fprintf(&sb, "会话: %s\n", sessionKey)
+
+	b.mu.Lock()
+	run := b.runs[sessionKey]
+	b.mu.Unlock()
+	if run != nil {
+		fmt.Fprintf(&sb, "当前回复: 进行中 (已运行 %s)\n", time.Since(run.startedAt).Round(time.Second))
+	} else {
+		sb.WriteString("当前回复: 无\n")
+	}
+	fmt.Fprintf(&sb, "排队消息: %d\n", b.queue.pending(sessionKey))
+	fmt.Fprintf(&sb, "进行中的运行: %d\n", b.moltbotCli.ActiveRuns())
+	fmt.Fprintf(&sb, "已运行: %s", time.Since(b.startedAt).Round(time.Second))
+	return sb.String()
+}
+
+// agentFor 返回会话使用的 Agent
+func (b *Bridge) agentFor(chatID string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if agentID, ok := b.chatAgents[chatID]; ok {
+		return agentID
+	}
+	return b.moltbotCli.AgentID()
+}
+
+// trackRun 登记会话上进行中的运行
+func (b *Bridge) trackRun(sessionKey string, run *activeRun) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.runs[sessionKey] = run
+}
+
+func (b *Bridge) untrackRun(sessionKey string, run *activeRun) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.runs[sessionKey] == run {
+		delete(b.runs, sessionKey)
+	}
+}
+
+// stopRun 停止会话上进行中的运行, 没有运行时返回 false
+func (b *Bridge) stopRun(sessionKey string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	run, ok := b.runs[sessionKey]
+	if !ok || run.stopped {
+		return false
+	}
+	run.stopped = true
+	close(run.stop)
+	return true
+}
+
+// cancelByMessage 停止由指定飞书消息触发的运行, 用于停止按钮和消息撤回
+func (b *Bridge) cancelByMessage(_ context.Context, messageID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, run := range b.runs {
+		if run.messageID == messageID && !run.stopped {
+			run.stopped = true
+			close(run.stop)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package bridge
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+)
+
+// 消息时间格式, 带时区以便 agent 换算
+const envelopeTimeLayout = "2006-01-02 15:04:05 -07:00"
+
+// envelopeLineRe 匹配正文中与来源信息格式相同的行
+var envelopeLineRe = regexp.MustCompile(`(?m)^(\s*)\[(\s*飞书)`)
+
+// envelope 在消息正文前加上来源信息, 让 agent 知道是谁在哪个会话中提问
+// Gateway 的 agent 请求只有 message 文本字段, 来源信息以首行的形式放在正文中
+// 格式如: [飞书 群聊 "研发群" chat_id=oc_xxx | 发送者: "张三" open_id=ou_xxx | message_id=om_xxx | 2026-01-02 15:04:05 +08:00]
+// 正文中以 "[飞书" 开头的行改为全角括号, 用户无法伪造来源信息
+func envelope(msg *feishu.InboundMessage) string {
+	var fields []string
+
+	switch msg.ChatType {
+	case "p2p":
+		fields = append(fields, "飞书 私聊")
+	default:
+		chat := "飞书 群聊"
+		if msg.ChatName != "" {
+			chat += fmt.Sprintf(" %q", msg.ChatName)
+		}
+		fields = append(fields, chat+" chat_id="+msg.ChatID)
+	}
+
+	sender := "发送者:"
+	if msg.SenderName != "" {
+		sender += fmt.Sprintf(" %q", msg.SenderName)
+	}
+	fields = append(fields, sender+" open_id="+msg.SenderID)
+
+	ids := "message_id=" + msg.MessageID
+	if msg.RootID != "" {
+		ids += " root_id=" + msg.RootID
+	}
+	if msg.ThreadID != "" {
+		ids += " thread_id=" + msg.ThreadID
+	}
+	fields = append(fields, ids)
+
+	if !msg.CreateTime.IsZero() {
+		fields = append(fields, msg.CreateTime.Format(envelopeTimeLayout))
+	}
+
+	text := envelopeLineRe.ReplaceAllString(msg.Text, "${1}［${2}")
+	return "[" + strings.Join(fields, " | ") + "]\n" + text
+}
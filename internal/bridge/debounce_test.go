@@ -0,0 +1,36 @@
+package bridge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+)
+
+func TestDispatcherDebounce(t *testing.T) {
+	ctx := context.Background()
+	r := newRecorder()
+	close(r.release)
+	d := newDispatcher(4, 5, config.QueueOverflowReject, 50*time.Millisecond, r.handle)
+
+	// 同一用户在窗口内的消息合并为一条
+	d.submit("s", r.job(ctx, "a", "u1"))
+	d.submit("s", r.job(ctx, "b", "u1"))
+	if n := d.pending("s"); n != 1 {
+		t.Fatalf("pending = %d, want 1", n)
+	}
+	r.waitStarted(t, "a\nb")
+
+	// 其他用户的消息使缓冲的消息立即进入队列, 自身等待窗口结束
+	d.submit("s", r.job(ctx, "c", "u1"))
+	d.submit("s", r.job(ctx, "d", "u2"))
+	r.waitStarted(t, "c")
+	r.waitStarted(t, "d")
+
+	select {
+	case text := <-r.started:
+		t.Fatalf("unexpected message %q", text)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
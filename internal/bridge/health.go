@@ -0,0 +1,86 @@
+package bridge
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+)
+
+// connStatus 一条连接的健康状态
+type connStatus struct {
+	Mode        string     `json:"mode,omitempty"`
+	Connected   bool       `json:"connected"`
+	Reconnects  int        `json:"reconnects"`
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+}
+
+// healthStatus 健康检查响应
+type healthStatus struct {
+	Status  string      `json:"status"`
+	Uptime  string      `json:"uptime"`
+	Gateway *connStatus `json:"gateway,omitempty"`
+	Feishu  *connStatus `json:"feishu,omitempty"`
+}
+
+// RegisterHealthHandlers 注册健康检查接口
+// /healthz 和 /livez 表示进程存活; /readyz 在 Gateway 和飞书长连接 (或事件回调) 均已就绪时返回 200, 否则返回 503
+func (b *Bridge) RegisterHealthHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", b.handleLive)
+	mux.HandleFunc("/livez", b.handleLive)
+	mux.HandleFunc("/readyz", b.handleReady)
+}
+
+// RegisterEventHandler 在 Webhook 模式下注册飞书事件回调接口, 长连接模式下不注册
+func (b *Bridge) RegisterEventHandler(mux *http.ServeMux) {
+	if b.cfg.EventMode != config.EventModeWebhook {
+		return
+	}
+	mux.Handle(b.cfg.WebhookPath, b.feishuCli.EventHandler())
+}
+
+func (b *Bridge) handleLive(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ok", Uptime: b.uptime()})
+}
+
+func (b *Bridge) handleReady(w http.ResponseWriter, _ *http.Request) {
+	feishuState := b.feishuCli.ConnState()
+	gateway := &connStatus{
+		Connected:   b.moltbotCli.Connected(),
+		Reconnects:  b.moltbotCli.Reconnects(),
+		LastEventAt: timePtr(b.moltbotCli.LastEventAt()),
+	}
+	feishu := &connStatus{
+		Mode:        feishuState.Mode,
+		Connected:   feishuState.Connected,
+		Reconnects:  feishuState.Reconnects,
+		LastEventAt: timePtr(feishuState.LastEventAt),
+	}
+
+	status := healthStatus{Status: "ready", Uptime: b.uptime(), Gateway: gateway, Feishu: feishu}
+	code := http.StatusOK
+	if !gateway.Connected || !feishu.Connected {
+		status.Status = "not_ready"
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+func (b *Bridge) uptime() string {
+	return time.Since(b.startedAt).Round(time.Second).String()
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// timePtr 零值时间返回 nil, 以便在 JSON 中省略
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
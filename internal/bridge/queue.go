@@ -0,0 +1,209 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+)
+
+// job 排队等待处理的消息
+type job struct {
+	ctx   context.Context
+	msg   *feishu.InboundMessage
+	reply feishu.ReplyFunc
+	// submitted 为提交时间, 合并的消息保留最早的提交时间
+	submitted time.Time
+}
+
+// jobHandler 处理一条排队消息
+type jobHandler func(ctx context.Context, sessionKey string, msg *feishu.InboundMessage, reply feishu.ReplyFunc)
+
+// debounced 防抖窗口内等待合并的消息
+type debounced struct {
+	job   *job
+	timer *time.Timer
+}
+
+// dispatcher 按会话键串行处理消息, 并限制同时处理的会话数
+// 每个有排队消息的会话对应一个 worker, worker 在队列清空后退出
+type dispatcher struct {
+	size     int
+	overflow string
+	debounce time.Duration
+	sem      chan struct{}
+	handle   jobHandler
+
+	// queues 记录有 worker 运行的会话及其排队消息, buffers 记录防抖窗口内的消息
+	queues  map[string][]*job
+	buffers map[string]*debounced
+	mu      sync.Mutex
+}
+
+func newDispatcher(workers, size int, overflow string, debounce time.Duration, handle jobHandler) *dispatcher {
+	return &dispatcher{
+		size:     size,
+		overflow: overflow,
+		debounce: debounce,
+		sem:      make(chan struct{}, workers),
+		handle:   handle,
+		queues:   make(map[string][]*job),
+		buffers:  make(map[string]*debounced),
+	}
+}
+
+// submit 提交一条消息
+// 开启防抖时, 同一用户在窗口内连续发送的消息合并为一条, 窗口结束后才进入队列;
+// 其他用户的消息会使已缓冲的消息立即进入队列
+func (d *dispatcher) submit(sessionKey string, j *job) {
+	j.submitted = time.Now()
+	if d.debounce <= 0 {
+		d.enqueue(sessionKey, j)
+		return
+	}
+
+	d.mu.Lock()
+	buf := d.buffers[sessionKey]
+	if buf != nil && buf.job.msg.SenderID == j.msg.SenderID {
+		buf.job.msg = mergeMessages(buf.job.msg, j.msg)
+		buf.job.reply = j.reply
+		buf.timer.Reset(d.debounce)
+		d.mu.Unlock()
+		msgLogger(j.msg, sessionKey).Info("合并连续消息")
+		return
+	}
+
+	var flushed *job
+	if buf != nil {
+		buf.timer.Stop()
+		flushed = buf.job
+	}
+	buf = &debounced{job: j}
+	buf.timer = time.AfterFunc(d.debounce, func() { d.flush(sessionKey, buf) })
+	d.buffers[sessionKey] = buf
+	d.mu.Unlock()
+
+	if flushed != nil {
+		d.enqueue(sessionKey, flushed)
+	}
+}
+
+// flush 防抖窗口结束, 将缓冲的消息放入队列
+// 缓冲已被其他用户的消息提前放入队列时不做处理
+func (d *dispatcher) flush(sessionKey string, buf *debounced) {
+	d.mu.Lock()
+	if d.buffers[sessionKey] != buf {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.buffers, sessionKey)
+	d.mu.Unlock()
+
+	d.enqueue(sessionKey, buf.job)
+}
+
+// enqueue 将消息加入会话队列, 该会话没有 worker 时启动一个
+// 队列已满时按溢出策略拒绝新消息、合并到最后一条排队消息或丢弃最早的消息
+func (d *dispatcher) enqueue(sessionKey string, j *job) {
+	d.mu.Lock()
+	pending, running := d.queues[sessionKey]
+	if !running {
+		go d.work(sessionKey)
+	}
+
+	var dropped *job
+	if len(pending) >= d.size {
+		switch d.overflow {
+		case config.QueueOverflowMerge:
+			last := pending[len(pending)-1]
+			last.msg = mergeMessages(last.msg, j.msg)
+			last.reply = j.reply
+			d.mu.Unlock()
+			msgLogger(j.msg, sessionKey).Info("排队已满, 合并消息")
+			return
+		case config.QueueOverflowDropOldest:
+			dropped, pending = pending[0], pending[1:]
+		default:
+			d.mu.Unlock()
+			logger := msgLogger(j.msg, sessionKey)
+			logger.Warn("排队已满, 拒绝消息")
+			if err := j.reply("当前会话排队的消息过多, 请稍后再试", true); err != nil {
+				logger.Warn("发送回复失败", "error", err)
+			}
+			return
+		}
+	}
+	d.queues[sessionKey] = append(pending, j)
+	d.mu.Unlock()
+
+	if dropped != nil {
+		logger := msgLogger(dropped.msg, sessionKey)
+		logger.Warn("排队已满, 丢弃最早的消息")
+		if err := dropped.reply("消息过多, 已跳过这条消息", true); err != nil {
+			logger.Warn("发送回复失败", "error", err)
+		}
+	}
+}
+
+// work 依次处理会话的排队消息, 每条消息处理前占用一个全局并发名额
+func (d *dispatcher) work(sessionKey string) {
+	for {
+		d.mu.Lock()
+		pending := d.queues[sessionKey]
+		if len(pending) == 0 {
+			delete(d.queues, sessionKey)
+			d.mu.Unlock()
+			return
+		}
+		ctx := pending[0].ctx
+		d.mu.Unlock()
+
+		select {
+		case d.sem <- struct{}{}:
+		case <-ctx.Done():
+			d.mu.Lock()
+			delete(d.queues, sessionKey)
+			d.mu.Unlock()
+			return
+		}
+
+		// 等待名额期间队首可能已被丢弃, 取出时重新读取
+		d.mu.Lock()
+		j := d.queues[sessionKey][0]
+		d.queues[sessionKey] = d.queues[sessionKey][1:]
+		d.mu.Unlock()
+
+		// 排队等待 (含防抖窗口和等待并发名额) 单独记为一个 span
+		_, span := tracer.Start(j.ctx, "bridge.queue_wait", trace.WithTimestamp(j.submitted),
+			trace.WithAttributes(attribute.String("session_key", sessionKey)))
+		span.End()
+
+		d.handle(j.ctx, sessionKey, j.msg, j.reply)
+		<-d.sem
+	}
+}
+
+// pending 返回会话排队中 (含防抖窗口内, 不含处理中) 的消息数
+func (d *dispatcher) pending(sessionKey string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.queues[sessionKey])
+	if _, ok := d.buffers[sessionKey]; ok {
+		n++
+	}
+	return n
+}
+
+// mergeMessages 将两条消息合并为一条, 回复锚定到较新的消息
+func mergeMessages(older, newer *feishu.InboundMessage) *feishu.InboundMessage {
+	merged := *newer
+	merged.Text = older.Text + "\n" + newer.Text
+	merged.Attachments = append(append([]feishu.Attachment(nil), older.Attachments...), newer.Attachments...)
+	merged.Mentions = append(append([]feishu.Mention(nil), older.Mentions...), newer.Mentions...)
+	return &merged
+}
@@ -0,0 +1,154 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+)
+
+// recorder 记录开始处理的消息和发出的回复, 处理器在 release 收到信号前阻塞
+type recorder struct {
+	started chan string
+	release chan struct{}
+
+	mu      sync.Mutex
+	replies map[string][]string
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		started: make(chan string, 16),
+		release: make(chan struct{}),
+		replies: make(map[string][]string),
+	}
+}
+
+func (r *recorder) handle(_ context.Context, _ string, msg *feishu.InboundMessage, _ feishu.ReplyFunc) {
+	r.started <- msg.Text
+	<-r.release
+}
+
+// job 创建一条消息, 回复记录在 id 名下
+func (r *recorder) job(ctx context.Context, id, sender string) *job {
+	return &job{
+		ctx: ctx,
+		msg: &feishu.InboundMessage{MessageID: id, SenderID: sender, Text: id},
+		reply: func(text string, _ bool) error {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.replies[id] = append(r.replies[id], text)
+			return nil
+		},
+	}
+}
+
+func (r *recorder) waitStarted(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-r.started:
+		if got != want {
+			t.Fatalf("started %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for %q to start", want)
+	}
+}
+
+func (r *recorder) repliesTo(id string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.replies[id]...)
+}
+
+func TestDispatcherOverflow(t *testing.T) {
+	tests := []struct {
+		overflow string
+		// 依次处理的消息, 以及收到通知的消息和内容
+		want     []string
+		notified string
+		notice   string
+	}{
+		{
+			overflow: config.QueueOverflowReject,
+			want:     []string{"a", "b"},
+			notified: "c",
+			notice:   "当前会话排队的消息过多, 请稍后再试",
+		},
+		{
+			overflow: config.QueueOverflowMerge,
+			want:     []string{"a", "b\nc"},
+		},
+		{
+			overflow: config.QueueOverflowDropOldest,
+			want:     []string{"a", "c"},
+			notified: "b",
+			notice:   "消息过多, 已跳过这条消息",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overflow, func(t *testing.T) {
+			ctx := context.Background()
+			r := newRecorder()
+			d := newDispatcher(1, 1, tt.overflow, 0, r.handle)
+
+			d.submit("s", r.job(ctx, "a", "u1"))
+			r.waitStarted(t, "a")
+			d.submit("s", r.job(ctx, "b", "u1"))
+			d.submit("s", r.job(ctx, "c", "u1"))
+			if n := d.pending("s"); n != 1 {
+				t.Fatalf("pending = %d, want 1", n)
+			}
+
+			for i, text := range tt.want {
+				if i > 0 {
+					r.waitStarted(t, text)
+				}
+				r.release <- struct{}{}
+			}
+
+			if tt.notified != "" {
+				got := r.repliesTo(tt.notified)
+				if len(got) != 1 || got[0] != tt.notice {
+					t.Errorf("replies to %q = %q, want [%q]", tt.notified, got, tt.notice)
+				}
+			}
+			for _, id := range []string{"a", "b", "c"} {
+				if id != tt.notified && len(r.repliesTo(id)) > 0 {
+					t.Errorf("unexpected replies to %q: %q", id, r.repliesTo(id))
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcherCanceled(t *testing.T) {
+	r := newRecorder()
+	d := newDispatcher(1, 5, config.QueueOverflowReject, 0, r.handle)
+
+	// s1 占用唯一的并发名额, s2 的消息在等待名额期间被取消
+	d.submit("s1", r.job(context.Background(), "a", "u1"))
+	r.waitStarted(t, "a")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.submit("s2", r.job(ctx, "b", "u2"))
+	cancel()
+
+	deadline := time.Now().Add(time.Second)
+	for d.pending("s2") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("canceled job still pending")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	r.release <- struct{}{}
+	select {
+	case text := <-r.started:
+		t.Fatalf("canceled message %q was handled", text)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+	"github.com/vogo/moltbot-feishu/internal/ratelimit"
+)
+
+// newLimiter 创建限流器, 配置了计数文件时计数在重启后保留
+func newLimiter(cfg *config.Config) (*ratelimit.Limiter, error) {
+	if cfg.RateLimitStore == "" {
+		return ratelimit.NewLimiter(ratelimit.NewMemoryStore()), nil
+	}
+	store, err := ratelimit.OpenFileStore(cfg.RateLimitStore)
+	if err != nil {
+		return nil, fmt.Errorf("打开限流计数文件失败: %w", err)
+	}
+	return ratelimit.NewLimiter(store), nil
+}
+
+// checkRateLimit 按用户和会话检查限流和每日配额, 超限时返回提示文本
+func (b *Bridge) checkRateLimit(msg *feishu.InboundMessage) (string, bool) {
+	userKey, chatKey := "user:"+msg.SenderID, "chat:"+msg.ChatID
+	now := time.Now()
+	d := b.limiter.Allow(now,
+		ratelimit.Check{Key: userKey, Rule: ratelimit.Rule{
+			PerMinute:  float64(b.cfg.UserRatePerMin),
+			Burst:      b.cfg.UserBurst,
+			DailyQuota: b.cfg.UserDailyQuota,
+		}},
+		ratelimit.Check{Key: chatKey, Rule: ratelimit.Rule{
+			PerMinute:  float64(b.cfg.ChatRatePerMin),
+			Burst:      b.cfg.ChatBurst,
+			DailyQuota: b.cfg.ChatDailyQuota,
+		}},
+	)
+	if d.Allowed {
+		return "", true
+	}
+
+	who := "你"
+	if d.Key == chatKey {
+		who = "本会话"
+	}
+	if d.Reason == ratelimit.ReasonQuota {
+		return fmt.Sprintf("%s今天的消息次数已用完, 请在%s后再试", who, retryText(now, d.RetryAt)), false
+	}
+	return fmt.Sprintf("%s发送消息过于频繁, 请在%s后再试", who, retryText(now, d.RetryAt)), false
+}
+
+// retryText 将重试时间转换为便于阅读的描述, 如 "30 秒"、"5 分钟"、"明天 00:00"
+func retryText(now, at time.Time) string {
+	wait := at.Sub(now)
+	switch {
+	case wait < time.Minute:
+		return fmt.Sprintf(" %d 秒", max(1, int(math.Ceil(wait.Seconds()))))
+	case wait < time.Hour:
+		return fmt.Sprintf(" %d 分钟", int(math.Ceil(wait.Minutes())))
+	}
+	y, m, d := now.Date()
+	if tomorrow := time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()); !at.Before(tomorrow) {
+		if at.Before(tomorrow.AddDate(0, 0, 1)) {
+			return " 明天 " + at.Format("15:04")
+		}
+		return " " + at.Format("01-02 15:04")
+	}
+	return " " + at.Format("15:04")
+}
@@ -0,0 +1,51 @@
+package bridge
+
+import (
+	"strings"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+)
+
+// 各隔离方式对应的会话键模板
+var sessionTemplates = map[string]string{
+	config.SessionScopeChat:   "feishu:{chat_id}",
+	config.SessionScopeUser:   "feishu:{chat_id}:{user_id}",
+	config.SessionScopeThread: "feishu:{chat_id}:{root_id}",
+}
+
+// sessionKey 根据配置的模板生成会话键
+// 可用占位符: {chat_id} {chat_type} {user_id} {message_id} {thread_id} {root_id}
+// 按话题隔离时, 不在话题中的消息和私聊消息按会话隔离
+func (b *Bridge) sessionKey(msg *feishu.InboundMessage) string {
+	rootID := threadRoot(msg)
+	tmpl := b.cfg.SessionTemplate
+	if tmpl == "" {
+		scope := b.cfg.SessionScope
+		if scope == config.SessionScopeThread && rootID == "" {
+			scope = config.SessionScopeChat
+		}
+		tmpl = sessionTemplates[scope]
+	}
+
+	return strings.NewReplacer(
+		"{chat_id}", msg.ChatID,
+		"{chat_type}", msg.ChatType,
+		"{user_id}", msg.SenderID,
+		"{message_id}", msg.MessageID,
+		"{thread_id}", msg.ThreadID,
+		"{root_id}", rootID,
+	).Replace(tmpl)
+}
+
+// threadRoot 返回群聊话题的根消息 ID, 不在话题中或私聊时为空
+// 话题的第一条消息 (如话题群中的帖子) 没有 root_id, 取自身 ID, 与话题内后续消息共用会话
+func threadRoot(msg *feishu.InboundMessage) string {
+	if msg.ThreadID == "" || msg.ChatType == "p2p" {
+		return ""
+	}
+	if msg.RootID != "" {
+		return msg.RootID
+	}
+	return msg.MessageID
+}
@@ -0,0 +1,49 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/vogo/moltbot-feishu/internal/config"
+	"github.com/vogo/moltbot-feishu/internal/feishu"
+)
+
+func TestSessionKey(t *testing.T) {
+	group := feishu.InboundMessage{ChatID: "oc_a", ChatType: "group", SenderID: "ou_a", MessageID: "om_1"}
+	// 话题内的回复, 根消息为 om_root
+	inThread := group
+	inThread.RootID, inThread.ThreadID = "om_root", "omt_1"
+	// 话题群中的帖子, 自身即为话题的根消息
+	topicPost := group
+	topicPost.ChatType, topicPost.MessageID, topicPost.ThreadID = "topic_group", "om_root", "omt_1"
+	// 引用回复, 不在话题中
+	quoted := group
+	quoted.RootID = "om_root"
+	p2pThread := inThread
+	p2pThread.ChatType = "p2p"
+
+	tests := []struct {
+		name     string
+		scope    string
+		template string
+		msg      feishu.InboundMessage
+		want     string
+	}{
+		{"chat", config.SessionScopeChat, "", inThread, "feishu:oc_a"},
+		{"user", config.SessionScopeUser, "", group, "feishu:oc_a:ou_a"},
+		{"thread reply", config.SessionScopeThread, "", inThread, "feishu:oc_a:om_root"},
+		{"thread root", config.SessionScopeThread, "", topicPost, "feishu:oc_a:om_root"},
+		{"thread scope outside thread", config.SessionScopeThread, "", group, "feishu:oc_a"},
+		{"thread scope quoted reply", config.SessionScopeThread, "", quoted, "feishu:oc_a"},
+		{"thread scope p2p", config.SessionScopeThread, "", p2pThread, "feishu:oc_a"},
+		{"template", config.SessionScopeChat, "bot:{chat_type}:{user_id}", group, "bot:group:ou_a"},
+		{"template root outside thread", config.SessionScopeChat, "x:{chat_id}:{root_id}", group, "x:oc_a:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bridge{cfg: &config.Config{SessionScope: tt.scope, SessionTemplate: tt.template}}
+			if got := b.sessionKey(&tt.msg); got != tt.want {
+				t.Errorf("sessionKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
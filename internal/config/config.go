@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -14,13 +17,159 @@ type Config struct {
 	FeishuAppID     string
 	FeishuAppSecret string
 
+	// 事件接收方式: ws 为长连接, webhook 为 HTTP 事件回调 (由 HTTPAddr 上的 WebhookPath 接收)
+	// FeishuVerificationToken 和 FeishuEncryptKey 对应开发者后台"事件与回调"中的配置
+	EventMode               string
+	WebhookPath             string
+	FeishuVerificationToken string
+	FeishuEncryptKey        string
+
 	// Moltbot 配置
 	MoltbotConfigPath string
 	MoltbotAgentID    string
 	GatewayPort       int
 	GatewayToken      string
+
+	// /agent 命令: MoltbotAgents 为可切换的 Agent, 为空时不允许切换
+	// AgentAdmins 为可切换 Agent 的用户 open_id, 为空时通过访问控制的用户均可切换
+	MoltbotAgents []string
+	AgentAdmins   []string
+
+	// 回复配置
+	ReplyMode        string // stream: 单张卡片流式更新; final: 运行结束后一次性发送
+	StreamIntervalMs int    // 流式模式下两次更新之间的最小间隔
+	ReplyTo          string // message: 引用触发消息回复; thread: 在话题中回复; chat: 直接发送到会话
+
+	// 会话键: 按会话、会话内用户或话题隔离 agent 上下文, SessionTemplate 不为空时优先使用
+	SessionScope    string
+	SessionTemplate string
+
+	// 渲染方式: card 渲染为消息卡片, text 纯文本; ChatRenderModes 按 chat_id 覆盖
+	RenderMode      string
+	ChatRenderModes map[string]string
+
+	// 文件附件限制: 大小上限 (字节) 和允许的扩展名, AllowedFileTypes 为空表示不限制类型
+	MaxFileBytes     int64
+	AllowedFileTypes []string
+
+	// 思考中提示: 超过阈值仍未收到回复时显示, 阈值为 0 表示关闭
+	ThinkingThresholdMs int
+	ThinkingText        string
+
+	// 消息队列: 同一会话的消息按顺序处理, MaxConcurrency 限制同时处理的会话数
+	// QueueSize 为每个会话的排队上限, 排满后按 QueueOverflow 处理
+	MaxConcurrency int
+	QueueSize      int
+	QueueOverflow  string
+
+	// 防抖: 同一用户在窗口内连续发送的消息合并为一次 agent 调用, 0 表示关闭
+	DebounceMs int
+
+	// 群聊响应策略, ChatGroupPolicies 按 chat_id 覆盖
+	GroupPolicy       GroupPolicy
+	ChatGroupPolicies map[string]GroupPolicy
+
+	// 访问控制: 按用户、部门和会话设置允许和拒绝名单
+	Access AccessPolicy
+
+	// 限流: 按用户和会话的令牌桶 (每分钟消息数, 突发上限) 及每日消息配额, 0 表示不限制
+	// RateLimitStore 为计数文件路径, 为空时计数只保存在内存中
+	UserRatePerMin int
+	UserBurst      int
+	UserDailyQuota int
+	ChatRatePerMin int
+	ChatBurst      int
+	ChatDailyQuota int
+	RateLimitStore string
+
+	// HTTP 监听地址, 提供健康检查接口, 为空表示不启动
+	HTTPAddr string
+
+	// 日志: 级别 (debug、info、warn、error)、格式 (text、json)
+	// LogRedact 为 true 时隐藏消息正文和令牌, 排查问题时可关闭
+	LogLevel  string
+	LogFormat string
+	LogRedact bool
+
+	// 链路追踪: 导出方式 (none、otlp、stdout) 和 OTLP/HTTP 采集器地址
+	TraceExporter string
+	TraceEndpoint string
+}
+
+// GroupPolicy 群聊响应策略
+type GroupPolicy struct {
+	Mode     string   `json:"mode"`
+	Keywords []string `json:"keywords,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+
+	// Regexps 为编译后的 Patterns
+	Regexps []*regexp.Regexp `json:"-"`
+}
+
+// GroupPolicyFile 群聊响应策略文件
+type GroupPolicyFile struct {
+	Default GroupPolicy            `json:"default"`
+	Chats   map[string]GroupPolicy `json:"chats"`
+}
+
+// AccessList 访问名单, Users 可填写 open_id 或 union_id, Departments 为 open_department_id
+type AccessList struct {
+	Users       []string `json:"users,omitempty"`
+	Departments []string `json:"departments,omitempty"`
+	Chats       []string `json:"chats,omitempty"`
 }
 
+// AccessPolicy 访问控制策略
+// 命中拒绝名单的消息一律拒绝; 允许名单不为空时, 发送者或会话须命中其中一项
+type AccessPolicy struct {
+	Allow      AccessList `json:"allow"`
+	Deny       AccessList `json:"deny"`
+	DeniedText string     `json:"denied_text,omitempty"`
+}
+
+// 默认群聊关键词: 英文疑问词按整词匹配, 中文请求词按子串匹配
+const defaultGroupKeywords = "why,how,what,when,where,who,help," +
+	"帮,麻烦,请,能否,可以,解释,看看,排查,分析,总结,写,改,修,查,对比,翻译"
+
+// 默认群聊正则规则: 以问号结尾, 或以机器人名称开头
+var defaultGroupPatterns = []string{
+	`[?？]\s*$`,
+	`(?i)^(moltbot|bot)\b`,
+	`^(助手|智能体)`,
+}
+
+// 默认允许的文件扩展名: 文本、数据、源码和 PDF
+const defaultFileTypes = "txt,log,md,csv,tsv,json,jsonl,yaml,yml,toml,ini,conf,xml,html,sql,sh," +
+	"go,py,js,ts,tsx,jsx,java,kt,c,h,cc,cpp,hpp,cs,rs,rb,php,swift,lua,proto,diff,patch,pdf"
+
+const (
+	EventModeWS      = "ws"
+	EventModeWebhook = "webhook"
+
+	ReplyModeStream = "stream"
+	ReplyModeFinal  = "final"
+
+	RenderModeCard = "card"
+	RenderModeText = "text"
+
+	SessionScopeChat   = "chat"
+	SessionScopeUser   = "user"
+	SessionScopeThread = "thread"
+
+	ReplyToMessage = "message"
+	ReplyToThread  = "thread"
+	ReplyToChat    = "chat"
+
+	QueueOverflowReject     = "reject"      // 拒绝新消息并提示用户
+	QueueOverflowMerge      = "merge"       // 将新消息合并到最后一条排队消息
+	QueueOverflowDropOldest = "drop-oldest" // 丢弃最早的排队消息
+
+	GroupPolicyMention  = "mention"
+	GroupPolicyAlways   = "always"
+	GroupPolicyKeywords = "keywords"
+	GroupPolicyOff      = "off"
+)
+
 type MoltbotConfig struct {
 	Gateway struct {
 		Port int    `json:"port"`
@@ -46,6 +195,59 @@ func getEnvOrDefault(key, defaultVal string) string {
 	return defaultVal
 }
 
+// splitList 解析逗号分隔的列表, 忽略空项
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// 会话键模板的占位符, 模板须包含 sessionScopePlaceholders 之一, 否则不同会话的消息会共用 agent 上下文
+var (
+	sessionPlaceholderRe     = regexp.MustCompile(`\{[^{}]*\}`)
+	sessionPlaceholders      = []string{"{chat_id}", "{chat_type}", "{user_id}", "{message_id}", "{thread_id}", "{root_id}"}
+	sessionScopePlaceholders = []string{"{chat_id}", "{user_id}", "{root_id}"}
+)
+
+// validateSessionTemplate 检查自定义会话键模板, 空模板表示使用隔离方式对应的模板
+func validateSessionTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	for _, p := range sessionPlaceholderRe.FindAllString(tmpl, -1) {
+		if !slices.Contains(sessionPlaceholders, p) {
+			return fmt.Errorf("会话键模板中的占位符 %s 无效，可选值: %s", p, strings.Join(sessionPlaceholders, "、"))
+		}
+	}
+	for _, p := range sessionScopePlaceholders {
+		if strings.Contains(tmpl, p) {
+			return nil
+		}
+	}
+	return fmt.Errorf("会话键模板 %q 须包含 %s 之一", tmpl, strings.Join(sessionScopePlaceholders, "、"))
+}
+
+// parseKeyValues 解析 "k1=v1,k2=v2" 格式的列表
+func parseKeyValues(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("格式错误: %q, 应为 key=value", item)
+		}
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result, nil
+}
+
 func getEnvIntOrDefault(key string, defaultVal int) int {
 	if val := os.Getenv(key); val != "" {
 		var i int
@@ -61,10 +263,56 @@ type Flags struct {
 	FeishuAppID      string
 	FeishuAppSecret  string
 	FeishuSecretPath string
+	EventMode        string
+	WebhookPath      string
+	VerifyToken      string
+	EncryptKey       string
 	MoltbotConfig    string
 	AgentID          string
+	Agents           string
+	AgentAdmins      string
 	GatewayPort      int
 	GatewayToken     string
+	ReplyMode        string
+	StreamIntervalMs int
+	ReplyTo          string
+	SessionScope     string
+	SessionTemplate  string
+	ThinkingMs       int
+	ThinkingText     string
+	RenderMode       string
+	ChatRenderModes  string
+	FileMaxMB        int
+	FileTypes        string
+	MaxConcurrency   int
+	QueueSize        int
+	QueueOverflow    string
+	DebounceMs       int
+	GroupPolicy      string
+	GroupKeywords    string
+	GroupPolicyFile  string
+	ChatGroupPolicy  string
+	AccessFile       string
+	AllowUsers       string
+	DenyUsers        string
+	AllowDepts       string
+	DenyDepts        string
+	AllowChats       string
+	DenyChats        string
+	DeniedText       string
+	UserRate         int
+	UserBurst        int
+	UserDailyQuota   int
+	ChatRate         int
+	ChatBurst        int
+	ChatDailyQuota   int
+	RateLimitStore   string
+	HTTPAddr         string
+	LogLevel         string
+	LogFormat        string
+	LogRedact        string
+	TraceExporter    string
+	TraceEndpoint    string
 	Version          bool
 }
 
@@ -74,10 +322,56 @@ func RegisterFlags() *Flags {
 	flag.StringVar(&f.FeishuAppID, "feishu-app-id", "", "飞书应用 App ID")
 	flag.StringVar(&f.FeishuAppSecret, "feishu-app-secret", "", "飞书应用 App Secret")
 	flag.StringVar(&f.FeishuSecretPath, "feishu-secret-path", "", "飞书应用 Secret 文件路径")
+	flag.StringVar(&f.EventMode, "event-mode", "", "事件接收方式: ws (长连接) 或 webhook (HTTP 事件回调)")
+	flag.StringVar(&f.WebhookPath, "webhook-path", "", "Webhook 模式下接收事件回调的路径")
+	flag.StringVar(&f.VerifyToken, "verification-token", "", "Webhook 模式下的事件 Verification Token")
+	flag.StringVar(&f.EncryptKey, "encrypt-key", "", "Webhook 模式下的事件 Encrypt Key")
 	flag.StringVar(&f.MoltbotConfig, "moltbot-config", "", "Moltbot 配置文件路径")
 	flag.StringVar(&f.AgentID, "agent-id", "", "Moltbot Agent ID")
+	flag.StringVar(&f.Agents, "agents", "", "/agent 命令可切换的 Agent ID, 逗号分隔, 为空时不允许切换")
+	flag.StringVar(&f.AgentAdmins, "agent-admins", "", "可使用 /agent 切换 Agent 的用户 open_id, 逗号分隔")
 	flag.IntVar(&f.GatewayPort, "gateway-port", 0, "Gateway 端口")
 	flag.StringVar(&f.GatewayToken, "gateway-token", "", "Gateway 认证 Token")
+	flag.StringVar(&f.ReplyMode, "reply-mode", "", "回复方式: stream (流式更新卡片) 或 final (结束后一次性发送)")
+	flag.IntVar(&f.StreamIntervalMs, "stream-interval-ms", 0, "流式更新最小间隔(毫秒)")
+	flag.StringVar(&f.ReplyTo, "reply-to", "", "回复方式: message (引用回复)、thread (话题回复) 或 chat (直接发送)")
+	flag.StringVar(&f.SessionScope, "session-scope", "", "会话隔离方式: chat (按会话)、user (按会话内用户) 或 thread (按话题)")
+	flag.StringVar(&f.SessionTemplate, "session-template", "", "自定义会话键模板, 如 feishu:{chat_id}:{user_id}")
+	flag.IntVar(&f.ThinkingMs, "thinking-ms", -1, "\"正在思考...\"提示延迟(毫秒), 0 表示关闭")
+	flag.StringVar(&f.ThinkingText, "thinking-text", "", "\"正在思考...\"提示文本")
+	flag.StringVar(&f.RenderMode, "render-mode", "", "回复渲染方式: card (消息卡片) 或 text (纯文本)")
+	flag.StringVar(&f.ChatRenderModes, "chat-render-modes", "", "按会话覆盖渲染方式, 格式: chat_id=text,chat_id=card")
+	flag.IntVar(&f.FileMaxMB, "file-max-mb", 0, "文件附件大小上限(MB)")
+	flag.StringVar(&f.FileTypes, "file-types", "", "允许的文件扩展名, 逗号分隔, * 表示不限制")
+	flag.IntVar(&f.MaxConcurrency, "max-concurrency", 0, "同时处理消息的会话数上限")
+	flag.IntVar(&f.QueueSize, "queue-size", 0, "每个会话的排队消息上限")
+	flag.StringVar(&f.QueueOverflow, "queue-overflow", "", "排队已满时的处理方式: reject (拒绝)、merge (合并) 或 drop-oldest (丢弃最早)")
+	flag.IntVar(&f.DebounceMs, "debounce-ms", -1, "连续消息合并窗口(毫秒), 0 表示关闭")
+	flag.StringVar(&f.GroupPolicy, "group-policy", "", "群聊响应策略: mention、always、keywords 或 off")
+	flag.StringVar(&f.GroupKeywords, "group-keywords", "", "群聊关键词, 逗号分隔")
+	flag.StringVar(&f.GroupPolicyFile, "group-policy-file", "", "群聊响应策略文件路径 (JSON)")
+	flag.StringVar(&f.ChatGroupPolicy, "chat-group-policies", "", "按会话覆盖群聊响应策略, 格式: chat_id=always,chat_id=off")
+	flag.StringVar(&f.AccessFile, "access-file", "", "访问控制文件路径 (JSON)")
+	flag.StringVar(&f.AllowUsers, "allow-users", "", "允许使用的用户 open_id 或 union_id, 逗号分隔")
+	flag.StringVar(&f.DenyUsers, "deny-users", "", "禁止使用的用户 open_id 或 union_id, 逗号分隔")
+	flag.StringVar(&f.AllowDepts, "allow-departments", "", "允许使用的部门 open_department_id, 逗号分隔")
+	flag.StringVar(&f.DenyDepts, "deny-departments", "", "禁止使用的部门 open_department_id, 逗号分隔")
+	flag.StringVar(&f.AllowChats, "allow-chats", "", "允许使用的会话 chat_id, 逗号分隔")
+	flag.StringVar(&f.DenyChats, "deny-chats", "", "禁止使用的会话 chat_id, 逗号分隔")
+	flag.StringVar(&f.DeniedText, "access-denied-text", "", "拒绝访问时的回复文本")
+	flag.IntVar(&f.UserRate, "user-rate", 0, "每个用户每分钟的消息数上限, 0 表示不限制")
+	flag.IntVar(&f.UserBurst, "user-burst", 0, "每个用户的突发消息数上限, 默认与 --user-rate 相同")
+	flag.IntVar(&f.UserDailyQuota, "user-daily-quota", 0, "每个用户每日的消息数上限, 0 表示不限制")
+	flag.IntVar(&f.ChatRate, "chat-rate", 0, "每个会话每分钟的消息数上限, 0 表示不限制")
+	flag.IntVar(&f.ChatBurst, "chat-burst", 0, "每个会话的突发消息数上限, 默认与 --chat-rate 相同")
+	flag.IntVar(&f.ChatDailyQuota, "chat-daily-quota", 0, "每个会话每日的消息数上限, 0 表示不限制")
+	flag.StringVar(&f.RateLimitStore, "rate-limit-store", "", "限流计数文件路径, 为空时只保存在内存中")
+	flag.StringVar(&f.HTTPAddr, "http-addr", "", "HTTP 监听地址 (健康检查), 如 :8080, 为空表示不启动")
+	flag.StringVar(&f.LogLevel, "log-level", "", "日志级别: debug、info、warn 或 error")
+	flag.StringVar(&f.LogFormat, "log-format", "", "日志格式: text 或 json")
+	flag.StringVar(&f.LogRedact, "log-redact", "", "是否隐藏日志中的消息正文和令牌: true 或 false")
+	flag.StringVar(&f.TraceExporter, "trace-exporter", "", "链路追踪导出方式: none、otlp 或 stdout")
+	flag.StringVar(&f.TraceEndpoint, "trace-endpoint", "", "OTLP/HTTP 采集器地址, 如 http://127.0.0.1:4318")
 	flag.BoolVar(&f.Version, "version", false, "显示版本号")
 	return f
 }
@@ -118,6 +412,33 @@ func Load(f *Flags) (*Config, error) {
 		return nil, fmt.Errorf("飞书 App Secret 未配置，请设置 --feishu-app-secret、FEISHU_APP_SECRET 或 FEISHU_APP_SECRET_PATH")
 	}
 
+	// 事件接收方式
+	cfg.EventMode = f.EventMode
+	if cfg.EventMode == "" {
+		cfg.EventMode = getEnvOrDefault("FEISHU_EVENT_MODE", EventModeWS)
+	}
+	if cfg.EventMode != EventModeWS && cfg.EventMode != EventModeWebhook {
+		return nil, fmt.Errorf("事件接收方式 %q 无效，可选值: ws、webhook", cfg.EventMode)
+	}
+	cfg.WebhookPath = f.WebhookPath
+	if cfg.WebhookPath == "" {
+		cfg.WebhookPath = getEnvOrDefault("FEISHU_WEBHOOK_PATH", "/webhook/event")
+	}
+	if !strings.HasPrefix(cfg.WebhookPath, "/") {
+		return nil, fmt.Errorf("Webhook 路径 %q 无效，必须以 / 开头", cfg.WebhookPath)
+	}
+	cfg.FeishuVerificationToken = f.VerifyToken
+	if cfg.FeishuVerificationToken == "" {
+		cfg.FeishuVerificationToken = os.Getenv("FEISHU_VERIFICATION_TOKEN")
+	}
+	cfg.FeishuEncryptKey = f.EncryptKey
+	if cfg.FeishuEncryptKey == "" {
+		cfg.FeishuEncryptKey = os.Getenv("FEISHU_ENCRYPT_KEY")
+	}
+	if cfg.EventMode == EventModeWebhook && cfg.FeishuVerificationToken == "" {
+		return nil, fmt.Errorf("Webhook 模式需要配置 Verification Token，请设置 --verification-token 或 FEISHU_VERIFICATION_TOKEN")
+	}
+
 	// Moltbot 配置路径
 	cfg.MoltbotConfigPath = f.MoltbotConfig
 	if cfg.MoltbotConfigPath == "" {
@@ -130,6 +451,16 @@ func Load(f *Flags) (*Config, error) {
 	if cfg.MoltbotAgentID == "" {
 		cfg.MoltbotAgentID = getEnvOrDefault("MOLTBOT_AGENT_ID", "main")
 	}
+	agents := f.Agents
+	if agents == "" {
+		agents = os.Getenv("MOLTBOT_AGENTS")
+	}
+	cfg.MoltbotAgents = splitList(agents)
+	agentAdmins := f.AgentAdmins
+	if agentAdmins == "" {
+		agentAdmins = os.Getenv("FEISHU_AGENT_ADMINS")
+	}
+	cfg.AgentAdmins = splitList(agentAdmins)
 
 	// Gateway 配置 - 从 moltbot.json 读取
 	cfg.GatewayPort = f.GatewayPort
@@ -162,5 +493,353 @@ func Load(f *Flags) (*Config, error) {
 		return nil, fmt.Errorf("Gateway Token 未配置，请设置 --gateway-token、MOLTBOT_GATEWAY_TOKEN 或在 moltbot.json 中配置")
 	}
 
+	// 回复方式
+	cfg.ReplyMode = f.ReplyMode
+	if cfg.ReplyMode == "" {
+		cfg.ReplyMode = getEnvOrDefault("FEISHU_REPLY_MODE", ReplyModeStream)
+	}
+	if cfg.ReplyMode != ReplyModeStream && cfg.ReplyMode != ReplyModeFinal {
+		return nil, fmt.Errorf("回复方式 %q 无效，可选值: stream、final", cfg.ReplyMode)
+	}
+
+	// 流式更新间隔 (飞书单条消息更新频率有限制, 不宜过小)
+	cfg.StreamIntervalMs = f.StreamIntervalMs
+	if cfg.StreamIntervalMs <= 0 {
+		cfg.StreamIntervalMs = getEnvIntOrDefault("FEISHU_STREAM_INTERVAL_MS", 1000)
+	}
+
+	// 回复目标
+	cfg.ReplyTo = f.ReplyTo
+	if cfg.ReplyTo == "" {
+		cfg.ReplyTo = getEnvOrDefault("FEISHU_REPLY_TO", ReplyToMessage)
+	}
+	if cfg.ReplyTo != ReplyToMessage && cfg.ReplyTo != ReplyToThread && cfg.ReplyTo != ReplyToChat {
+		return nil, fmt.Errorf("回复方式 %q 无效，可选值: message、thread、chat", cfg.ReplyTo)
+	}
+
+	// 会话键
+	cfg.SessionScope = f.SessionScope
+	if cfg.SessionScope == "" {
+		cfg.SessionScope = getEnvOrDefault("FEISHU_SESSION_SCOPE", SessionScopeChat)
+	}
+	if cfg.SessionScope != SessionScopeChat && cfg.SessionScope != SessionScopeUser && cfg.SessionScope != SessionScopeThread {
+		return nil, fmt.Errorf("会话隔离方式 %q 无效，可选值: chat、user、thread", cfg.SessionScope)
+	}
+	cfg.SessionTemplate = f.SessionTemplate
+	if cfg.SessionTemplate == "" {
+		cfg.SessionTemplate = os.Getenv("FEISHU_SESSION_TEMPLATE")
+	}
+	if err := validateSessionTemplate(cfg.SessionTemplate); err != nil {
+		return nil, err
+	}
+
+	// 渲染方式
+	cfg.RenderMode = f.RenderMode
+	if cfg.RenderMode == "" {
+		cfg.RenderMode = getEnvOrDefault("FEISHU_RENDER_MODE", RenderModeCard)
+	}
+	chatRenderModes := f.ChatRenderModes
+	if chatRenderModes == "" {
+		chatRenderModes = os.Getenv("FEISHU_CHAT_RENDER_MODES")
+	}
+	modes, err := parseKeyValues(chatRenderModes)
+	if err != nil {
+		return nil, fmt.Errorf("会话渲染方式配置无效: %w", err)
+	}
+	cfg.ChatRenderModes = modes
+	for _, mode := range append([]string{cfg.RenderMode}, mapValues(modes)...) {
+		if mode != RenderModeCard && mode != RenderModeText {
+			return nil, fmt.Errorf("渲染方式 %q 无效，可选值: card、text", mode)
+		}
+	}
+
+	// 文件附件限制
+	fileMaxMB := f.FileMaxMB
+	if fileMaxMB <= 0 {
+		fileMaxMB = getEnvIntOrDefault("FEISHU_FILE_MAX_MB", 10)
+	}
+	cfg.MaxFileBytes = int64(fileMaxMB) << 20
+	fileTypes := f.FileTypes
+	if fileTypes == "" {
+		fileTypes = getEnvOrDefault("FEISHU_FILE_TYPES", defaultFileTypes)
+	}
+	if strings.TrimSpace(fileTypes) != "*" {
+		cfg.AllowedFileTypes = splitList(strings.ToLower(fileTypes))
+		for i, ext := range cfg.AllowedFileTypes {
+			cfg.AllowedFileTypes[i] = strings.TrimPrefix(ext, ".")
+		}
+	}
+
+	// 思考中提示 (0 为合法值, 表示关闭, 因此命令行默认值为 -1)
+	cfg.ThinkingThresholdMs = f.ThinkingMs
+	if cfg.ThinkingThresholdMs < 0 {
+		cfg.ThinkingThresholdMs = getEnvIntOrDefault("FEISHU_THINKING_THRESHOLD_MS", 2500)
+	}
+	cfg.ThinkingText = f.ThinkingText
+	if cfg.ThinkingText == "" {
+		cfg.ThinkingText = getEnvOrDefault("FEISHU_THINKING_TEXT", "正在思考...")
+	}
+
+	// 消息队列
+	cfg.MaxConcurrency = f.MaxConcurrency
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = getEnvIntOrDefault("FEISHU_MAX_CONCURRENCY", 8)
+	}
+	cfg.QueueSize = f.QueueSize
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = getEnvIntOrDefault("FEISHU_QUEUE_SIZE", 5)
+	}
+	if cfg.MaxConcurrency <= 0 || cfg.QueueSize <= 0 {
+		return nil, fmt.Errorf("并发数和排队上限必须大于 0")
+	}
+	cfg.QueueOverflow = f.QueueOverflow
+	if cfg.QueueOverflow == "" {
+		cfg.QueueOverflow = getEnvOrDefault("FEISHU_QUEUE_OVERFLOW", QueueOverflowReject)
+	}
+	if cfg.QueueOverflow != QueueOverflowReject && cfg.QueueOverflow != QueueOverflowMerge && cfg.QueueOverflow != QueueOverflowDropOldest {
+		return nil, fmt.Errorf("排队溢出策略 %q 无效，可选值: reject、merge、drop-oldest", cfg.QueueOverflow)
+	}
+
+	// 连续消息合并窗口 (0 为合法值, 表示关闭, 因此命令行默认值为 -1)
+	cfg.DebounceMs = f.DebounceMs
+	if cfg.DebounceMs < 0 {
+		cfg.DebounceMs = getEnvIntOrDefault("FEISHU_DEBOUNCE_MS", 0)
+	}
+
+	// 群聊响应策略
+	if err := loadGroupPolicies(cfg, f); err != nil {
+		return nil, err
+	}
+
+	// 访问控制
+	if err := loadAccessPolicy(cfg, f); err != nil {
+		return nil, err
+	}
+
+	// 限流和每日配额
+	limits := []struct {
+		value *int
+		flag  int
+		env   string
+	}{
+		{&cfg.UserRatePerMin, f.UserRate, "FEISHU_USER_RATE"},
+		{&cfg.UserBurst, f.UserBurst, "FEISHU_USER_BURST"},
+		{&cfg.UserDailyQuota, f.UserDailyQuota, "FEISHU_USER_DAILY_QUOTA"},
+		{&cfg.ChatRatePerMin, f.ChatRate, "FEISHU_CHAT_RATE"},
+		{&cfg.ChatBurst, f.ChatBurst, "FEISHU_CHAT_BURST"},
+		{&cfg.ChatDailyQuota, f.ChatDailyQuota, "FEISHU_CHAT_DAILY_QUOTA"},
+	}
+	for _, l := range limits {
+		*l.value = l.flag
+		if *l.value <= 0 {
+			*l.value = getEnvIntOrDefault(l.env, 0)
+		}
+		if *l.value < 0 {
+			return nil, fmt.Errorf("%s 不能为负数", l.env)
+		}
+	}
+	cfg.RateLimitStore = f.RateLimitStore
+	if cfg.RateLimitStore == "" {
+		cfg.RateLimitStore = os.Getenv("FEISHU_RATE_LIMIT_STORE")
+	}
+	if cfg.RateLimitStore != "" {
+		cfg.RateLimitStore = expandPath(cfg.RateLimitStore)
+	}
+
+	// HTTP 监听地址
+	cfg.HTTPAddr = f.HTTPAddr
+	if cfg.HTTPAddr == "" {
+		cfg.HTTPAddr = os.Getenv("FEISHU_HTTP_ADDR")
+	}
+	if cfg.EventMode == EventModeWebhook && cfg.HTTPAddr == "" {
+		return nil, fmt.Errorf("Webhook 模式需要配置 HTTP 监听地址，请设置 --http-addr 或 FEISHU_HTTP_ADDR")
+	}
+
+	// 日志
+	cfg.LogLevel = f.LogLevel
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = getEnvOrDefault("FEISHU_LOG_LEVEL", "info")
+	}
+	cfg.LogFormat = f.LogFormat
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = getEnvOrDefault("FEISHU_LOG_FORMAT", "text")
+	}
+	logRedact := f.LogRedact
+	if logRedact == "" {
+		logRedact = getEnvOrDefault("FEISHU_LOG_REDACT", "true")
+	}
+	if cfg.LogRedact, err = strconv.ParseBool(logRedact); err != nil {
+		return nil, fmt.Errorf("日志脱敏配置 %q 无效，可选值: true、false", logRedact)
+	}
+
+	// 链路追踪
+	cfg.TraceExporter = f.TraceExporter
+	if cfg.TraceExporter == "" {
+		cfg.TraceExporter = getEnvOrDefault("FEISHU_TRACE_EXPORTER", "none")
+	}
+	cfg.TraceEndpoint = f.TraceEndpoint
+	if cfg.TraceEndpoint == "" {
+		cfg.TraceEndpoint = os.Getenv("FEISHU_TRACE_ENDPOINT")
+	}
+
 	return cfg, nil
 }
+
+// loadGroupPolicies 加载群聊响应策略
+// 默认策略的模式和关键词: 命令行参数 > 环境变量 > 策略文件 > 默认值
+// 会话策略中未设置的关键词和正则规则沿用默认策略
+func loadGroupPolicies(cfg *Config, f *Flags) error {
+	var file GroupPolicyFile
+	policyPath := f.GroupPolicyFile
+	if policyPath == "" {
+		policyPath = os.Getenv("FEISHU_GROUP_POLICY_FILE")
+	}
+	if policyPath != "" {
+		data, err := os.ReadFile(expandPath(policyPath))
+		if err != nil {
+			return fmt.Errorf("读取群聊响应策略文件失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("解析群聊响应策略文件失败: %w", err)
+		}
+	}
+
+	def := file.Default
+	if mode := f.GroupPolicy; mode != "" {
+		def.Mode = mode
+	} else if mode := os.Getenv("FEISHU_GROUP_POLICY"); mode != "" {
+		def.Mode = mode
+	} else if def.Mode == "" {
+		def.Mode = GroupPolicyKeywords
+	}
+	keywords := f.GroupKeywords
+	if keywords == "" {
+		keywords = os.Getenv("FEISHU_GROUP_KEYWORDS")
+	}
+	if keywords != "" {
+		def.Keywords = splitList(keywords)
+	} else if def.Keywords == nil {
+		def.Keywords = splitList(defaultGroupKeywords)
+	}
+	if def.Patterns == nil {
+		def.Patterns = defaultGroupPatterns
+	}
+	if err := compileGroupPolicy(&def); err != nil {
+		return err
+	}
+	cfg.GroupPolicy = def
+
+	chats := file.Chats
+	if chats == nil {
+		chats = make(map[string]GroupPolicy)
+	}
+	chatPolicies := f.ChatGroupPolicy
+	if chatPolicies == "" {
+		chatPolicies = os.Getenv("FEISHU_CHAT_GROUP_POLICIES")
+	}
+	modes, err := parseKeyValues(chatPolicies)
+	if err != nil {
+		return fmt.Errorf("会话群聊响应策略配置无效: %w", err)
+	}
+	for chatID, mode := range modes {
+		policy := chats[chatID]
+		policy.Mode = mode
+		chats[chatID] = policy
+	}
+
+	cfg.ChatGroupPolicies = make(map[string]GroupPolicy, len(chats))
+	for chatID, policy := range chats {
+		if policy.Mode == "" {
+			policy.Mode = def.Mode
+		}
+		if policy.Keywords == nil {
+			policy.Keywords = def.Keywords
+		}
+		if policy.Patterns == nil {
+			policy.Patterns = def.Patterns
+		}
+		if err := compileGroupPolicy(&policy); err != nil {
+			return fmt.Errorf("会话 %s: %w", chatID, err)
+		}
+		cfg.ChatGroupPolicies[chatID] = policy
+	}
+	return nil
+}
+
+// loadAccessPolicy 加载访问控制策略
+// 各名单: 命令行参数 > 环境变量 > 访问控制文件, 设置后整体替换文件中的同一名单
+func loadAccessPolicy(cfg *Config, f *Flags) error {
+	var policy AccessPolicy
+	accessPath := f.AccessFile
+	if accessPath == "" {
+		accessPath = os.Getenv("FEISHU_ACCESS_FILE")
+	}
+	if accessPath != "" {
+		data, err := os.ReadFile(expandPath(accessPath))
+		if err != nil {
+			return fmt.Errorf("读取访问控制文件失败: %w", err)
+		}
+		if err := json.Unmarshal(data, &policy); err != nil {
+			return fmt.Errorf("解析访问控制文件失败: %w", err)
+		}
+	}
+
+	lists := []struct {
+		list *[]string
+		flag string
+		env  string
+	}{
+		{&policy.Allow.Users, f.AllowUsers, "FEISHU_ALLOW_USERS"},
+		{&policy.Deny.Users, f.DenyUsers, "FEISHU_DENY_USERS"},
+		{&policy.Allow.Departments, f.AllowDepts, "FEISHU_ALLOW_DEPARTMENTS"},
+		{&policy.Deny.Departments, f.DenyDepts, "FEISHU_DENY_DEPARTMENTS"},
+		{&policy.Allow.Chats, f.AllowChats, "FEISHU_ALLOW_CHATS"},
+		{&policy.Deny.Chats, f.DenyChats, "FEISHU_DENY_CHATS"},
+	}
+	for _, l := range lists {
+		value := l.flag
+		if value == "" {
+			value = os.Getenv(l.env)
+		}
+		if value != "" {
+			*l.list = splitList(value)
+		}
+	}
+
+	if f.DeniedText != "" {
+		policy.DeniedText = f.DeniedText
+	} else if text := os.Getenv("FEISHU_ACCESS_DENIED_TEXT"); text != "" {
+		policy.DeniedText = text
+	} else if policy.DeniedText == "" {
+		policy.DeniedText = "抱歉, 你没有使用该机器人的权限, 如有需要请联系管理员"
+	}
+
+	cfg.Access = policy
+	return nil
+}
+
+// compileGroupPolicy 校验模式并编译正则规则
+func compileGroupPolicy(p *GroupPolicy) error {
+	switch p.Mode {
+	case GroupPolicyMention, GroupPolicyAlways, GroupPolicyKeywords, GroupPolicyOff:
+	default:
+		return fmt.Errorf("群聊响应策略 %q 无效，可选值: mention、always、keywords、off", p.Mode)
+	}
+	p.Regexps = make([]*regexp.Regexp, 0, len(p.Patterns))
+	for _, pattern := range p.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("群聊正则规则 %q 无效: %w", pattern, err)
+		}
+		p.Regexps = append(p.Regexps, re)
+	}
+	return nil
+}
+
+func mapValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
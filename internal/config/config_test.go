@@ -0,0 +1,27 @@
+package config
+
+import "testing"
+
+func TestValidateSessionTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl    string
+		wantErr bool
+	}{
+		{"", false},
+		{"feishu:{chat_id}", false},
+		{"feishu:{user_id}", false},
+		{"feishu:{chat_id}:{root_id}", false},
+		{"feishu:{chat_type}:{user_id}:{thread_id}:{message_id}", false},
+		{"feishu:{root}", true},
+		{"feishu:{chat_id}:{thread}", true},
+		{"feishu:{chat_type}", true},
+		{"feishu:{message_id}", true},
+		{"feishu", true},
+	}
+	for _, tt := range tests {
+		err := validateSessionTemplate(tt.tmpl)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateSessionTemplate(%q) error = %v, wantErr %v", tt.tmpl, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package feishu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// 机器人信息接口, SDK 未提供对应的封装
+const botInfoPath = "/open-apis/bot/v3/info"
+
+type botInfoResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Bot  struct {
+		AppName string `json:"app_name"`
+		OpenID  string `json:"open_id"`
+	} `json:"bot"`
+}
+
+// loadBotInfo 获取机器人自身的 open_id, 用于识别群聊中对机器人的 @ 提及
+func (c *Client) loadBotInfo(ctx context.Context) error {
+	resp, err := c.larkCli.Get(ctx, botInfoPath, nil, larkcore.AccessTokenTypeTenant)
+	if err != nil {
+		return err
+	}
+	var info botInfoResp
+	if err := json.Unmarshal(resp.RawBody, &info); err != nil {
+		return fmt.Errorf("解析机器人信息失败: %w", err)
+	}
+	if info.Code != 0 {
+		return fmt.Errorf("获取机器人信息失败: %s", info.Msg)
+	}
+	if info.Bot.OpenID == "" {
+		return fmt.Errorf("机器人信息中没有 open_id")
+	}
+	c.botOpenID = info.Bot.OpenID
+	c.botName = info.Bot.AppName
+	return nil
+}
+
+// isBotMention 判断是否为对机器人自身的提及
+// 未获取到机器人 open_id 时, 任何提及都视为提及机器人
+func (c *Client) isBotMention(mention *larkim.MentionEvent) bool {
+	if c.botOpenID == "" {
+		return true
+	}
+	return mention.Id != nil && stringValue(mention.Id.OpenId) == c.botOpenID
+}
+
+// mentionsBot 判断消息是否 @ 了机器人
+func (c *Client) mentionsBot(mentions []*larkim.MentionEvent) bool {
+	for _, mention := range mentions {
+		if c.isBotMention(mention) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+package feishu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher/callback"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Card 飞书消息卡片
+type Card struct {
+	Config   CardConfig    `json:"config"`
+	Elements []interface{} `json:"elements"`
+}
+
+type CardConfig struct {
+	WideScreenMode bool `json:"wide_screen_mode"`
+	// UpdateMulti 为 true 的共享卡片才能被 Patch 更新
+	UpdateMulti bool `json:"update_multi"`
+}
+
+// MarkdownElement 卡片 markdown 组件
+type MarkdownElement struct {
+	Tag     string `json:"tag"`
+	Content string `json:"content"`
+}
+
+// HrElement 卡片分割线
+type HrElement struct {
+	Tag string `json:"tag"`
+}
+
+// ColumnSetElement 卡片分栏, 用于渲染表格行
+type ColumnSetElement struct {
+	Tag             string          `json:"tag"`
+	FlexMode        string          `json:"flex_mode"`
+	BackgroundStyle string          `json:"background_style"`
+	Columns         []ColumnElement `json:"columns"`
+}
+
+type ColumnElement struct {
+	Tag           string        `json:"tag"`
+	Width         string        `json:"width"`
+	Weight        int           `json:"weight"`
+	VerticalAlign string        `json:"vertical_align"`
+	Elements      []interface{} `json:"elements"`
+}
+
+// ActionElement 卡片交互组件
+type ActionElement struct {
+	Tag     string          `json:"tag"`
+	Actions []ButtonElement `json:"actions"`
+}
+
+type ButtonElement struct {
+	Tag   string            `json:"tag"`
+	Text  PlainText         `json:"text"`
+	Type  string            `json:"type"`
+	Value map[string]string `json:"value"`
+}
+
+type PlainText struct {
+	Tag     string `json:"tag"`
+	Content string `json:"content"`
+}
+
+// 卡片按钮回传的动作
+const cardActionStop = "stop"
+
+// 卡片大小上限: 飞书卡片请求体上限约 30KB, 按序列化后的卡片 JSON 计算并预留请求的转义开销
+// 表格渲染为分栏后远大于原始 markdown, 组件数同样需要限制
+const (
+	maxCardBytes    = 25000
+	maxCardElements = 150
+)
+
+// 卡片正文截断或改为文本消息时附加的提示
+const (
+	cardOverflowNote = "…（回复过长，剩余内容将以文本消息发送）"
+	cardFallbackNote = "（后续内容以文本消息发送）"
+)
+
+// buildReplyCard 渲染回复卡片, 未结束的回复带停止按钮
+// 渲染结果超出卡片上限时, 二分查找能放入卡片的最长前缀, 剩余部分由调用方以文本消息发送
+func buildReplyCard(content string, users []Mention, msgID string, final bool) (card *Card, rest string) {
+	build := func(head string, truncated bool) *Card {
+		card := renderCard(head, users)
+		if truncated {
+			card.Elements = append(card.Elements, MarkdownElement{Tag: "markdown", Content: cardOverflowNote})
+		}
+		if !final {
+			card.Elements = append(card.Elements, stopButton(msgID))
+		}
+		return card
+	}
+
+	if card := build(content, false); cardFits(card) {
+		return card, ""
+	}
+	lo, hi := 0, len(content)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if cardFits(build(content[:runeCut(content, mid)], true)) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	cut := runeCut(content, lo)
+	// 尽量在换行处拆分, 避免截断到一行中间
+	if nl := strings.LastIndexByte(content[:cut], '\n'); nl > cut/2 {
+		cut = nl
+	}
+	return build(content[:cut], true), strings.TrimLeft(content[cut:], "\n")
+}
+
+// runeCut 返回不超过 n 的最大字符边界
+func runeCut(s string, n int) int {
+	for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+// cardFits 判断卡片序列化后的大小和组件数是否在上限内
+func cardFits(card *Card) bool {
+	if countElements(card.Elements) > maxCardElements {
+		return false
+	}
+	data, err := json.Marshal(card)
+	return err == nil && len(data) <= maxCardBytes
+}
+
+// countElements 统计组件数, 包括分栏内的组件
+func countElements(elements []interface{}) int {
+	n := 0
+	for _, el := range elements {
+		n++
+		if set, ok := el.(ColumnSetElement); ok {
+			for _, col := range set.Columns {
+				n += 1 + countElements(col.Elements)
+			}
+		}
+	}
+	return n
+}
+
+// withoutStopButton 返回移除停止按钮并附加提示的卡片副本
+func withoutStopButton(card *Card, note string) *Card {
+	cp := &Card{Config: card.Config}
+	for _, el := range card.Elements {
+		if _, ok := el.(ActionElement); !ok {
+			cp.Elements = append(cp.Elements, el)
+		}
+	}
+	cp.Elements = append(cp.Elements, MarkdownElement{Tag: "markdown", Content: note})
+	return cp
+}
+
+// stopButton 流式回复卡片上的停止按钮, 回传触发回复的消息 ID
+func stopButton(msgID string) ActionElement {
+	return ActionElement{
+		Tag: "action",
+		Actions: []ButtonElement{{
+			Tag:  "button",
+			Text: PlainText{Tag: "plain_text", Content: "停止"},
+			Type: "danger",
+			Value: map[string]string{
+				"action":     cardActionStop,
+				"message_id": msgID,
+			},
+		}},
+	}
+}
+
+// handleCardAction 处理卡片按钮回调
+func (c *Client) handleCardAction(ctx context.Context, event *callback.CardActionTriggerEvent) (*callback.CardActionTriggerResponse, error) {
+	c.monitor.touch()
+	if event.Event == nil || event.Event.Action == nil {
+		return nil, nil
+	}
+	value := event.Event.Action.Value
+	if action, _ := value["action"].(string); action != cardActionStop {
+		return nil, nil
+	}
+	msgID, _ := value["message_id"].(string)
+
+	toast := "回复已结束"
+	if msgID != "" && c.cancelHandler != nil && c.cancelHandler(ctx, msgID) {
+		toast = "已停止"
+	}
+	return &callback.CardActionTriggerResponse{
+		Toast: &callback.Toast{Type: "info", Content: toast},
+	}, nil
+}
+
+// sendCard 发送卡片, replyTo 为触发回复的消息 ID
+func (c *Client) sendCard(ctx context.Context, chatID, replyTo string, card *Card) (string, error) {
+	content, err := json.Marshal(card)
+	if err != nil {
+		return "", fmt.Errorf("序列化卡片失败: %w", err)
+	}
+	return c.deliver(ctx, chatID, replyTo, larkim.MsgTypeInteractive, string(content))
+}
+
+// patchCard 原地更新已发送的卡片
+func (c *Client) patchCard(ctx context.Context, msgID string, card *Card) error {
+	ctx, span := tracer.Start(ctx, "feishu.patch_card", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("message_id", msgID)))
+	defer span.End()
+
+	content, err := json.Marshal(card)
+	if err != nil {
+		return fmt.Errorf("序列化卡片失败: %w", err)
+	}
+
+	req := larkim.NewPatchMessageReqBuilder().
+		MessageId(msgID).
+		Body(larkim.NewPatchMessageReqBodyBuilder().
+			Content(string(content)).
+			Build()).
+		Build()
+
+	resp, err := c.larkCli.Im.V1.Message.Patch(ctx, req)
+	if err != nil {
+		return sendFailed(span, "patch", err)
+	}
+	if !resp.Success() {
+		return sendFailed(span, "patch", fmt.Errorf("更新卡片失败: %s", resp.Msg))
+	}
+	return nil
+}
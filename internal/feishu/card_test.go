@@ -0,0 +1,126 @@
+package feishu
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func md(content string) MarkdownElement { return MarkdownElement{Tag: "markdown", Content: content} }
+
+func TestRenderCard(t *testing.T) {
+	users := []Mention{{Name: "张三", OpenID: "ou_a"}, {Name: "<b>", OpenID: "ou_b"}}
+	cell := func(content string) ColumnElement {
+		return ColumnElement{Tag: "column", Width: "weighted", Weight: 1, VerticalAlign: "top", Elements: []interface{}{md(content)}}
+	}
+
+	tests := []struct {
+		name string
+		md   string
+		want []interface{}
+	}{
+		{
+			name: "empty",
+			md:   "",
+			want: []interface{}{md(" ")},
+		},
+		{
+			name: "heading and bullets",
+			md:   "## 步骤\n* 第一步\n  + 子项\n",
+			want: []interface{}{md("**步骤**\n- 第一步\n  - 子项")},
+		},
+		{
+			name: "rule splits paragraphs",
+			md:   "上\n---\n下",
+			want: []interface{}{md("上"), HrElement{Tag: "hr"}, md("下")},
+		},
+		{
+			name: "code block kept verbatim",
+			md:   "看代码:\n~~~go\nif a < b { @张三 }\n~~~\n完",
+			want: []interface{}{md("看代码:"), md("```go\nif a < b { @张三 }\n```"), md("完")},
+		},
+		{
+			// 流式输出中途的代码块尚未闭合
+			name: "unclosed code block",
+			md:   "```\nx := 1",
+			want: []interface{}{md("```\nx := 1\n```")},
+		},
+		{
+			name: "escape and mentions",
+			md:   "<at id=all></at> @张三 `@张三` @<b> @李四 ![图](https://x/y.png)",
+			want: []interface{}{md("&lt;at id=all&gt;&lt;/at&gt; <at id=ou_a></at> `@张三` <at id=ou_b></at> @李四 [图](https://x/y.png)")},
+		},
+		{
+			name: "table",
+			md:   "| 名称 | 值 |\n|:---|---:|\n| a | 1 |\n| b |\n结束",
+			want: []interface{}{
+				ColumnSetElement{Tag: "column_set", FlexMode: "none", BackgroundStyle: "grey", Columns: []ColumnElement{cell("**名称**"), cell("**值**")}},
+				ColumnSetElement{Tag: "column_set", FlexMode: "none", BackgroundStyle: "default", Columns: []ColumnElement{cell("a"), cell("1")}},
+				ColumnSetElement{Tag: "column_set", FlexMode: "none", BackgroundStyle: "default", Columns: []ColumnElement{cell("b"), cell(" ")}},
+				md("结束"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := renderCard(tt.md, users)
+			if !reflect.DeepEqual(card.Elements, tt.want) {
+				t.Errorf("elements =\n%#v\nwant\n%#v", card.Elements, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildReplyCard(t *testing.T) {
+	var table strings.Builder
+	table.WriteString("| a | b | c |\n|---|---|---|\n")
+	for i := 0; i < 100; i++ {
+		table.WriteString("| x | y | z |\n")
+	}
+
+	tests := []struct {
+		name      string
+		content   string
+		final     bool
+		truncated bool
+	}{
+		{name: "short", content: "你好", final: true},
+		{name: "short streaming", content: "你好"},
+		{name: "long text", content: strings.Repeat("这是一行很长的回复内容。\n", 2000), final: true, truncated: true},
+		{name: "long line", content: strings.Repeat("字", 20000), truncated: true},
+		// 原文不大, 但每行表格展开为多个分栏组件, 按组件数截断
+		{name: "wide table", content: table.String(), final: true, truncated: true},
+		// 尖括号转义后变长, 按序列化后的大小截断
+		{name: "escaped", content: strings.Repeat("<", 8000), final: true, truncated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, rest := buildReplyCard(tt.content, nil, "om_1", tt.final)
+			if !cardFits(card) {
+				t.Fatal("card exceeds limits")
+			}
+			if (rest != "") != tt.truncated {
+				t.Fatalf("rest = %d bytes, want truncated=%v", len(rest), tt.truncated)
+			}
+			last := card.Elements[len(card.Elements)-1]
+			if _, ok := last.(ActionElement); ok == tt.final {
+				t.Errorf("stop button present = %v, want %v", ok, !tt.final)
+			}
+			if !tt.truncated {
+				return
+			}
+			if !strings.HasSuffix(tt.content, rest) || len(rest) == len(tt.content) {
+				t.Errorf("rest (%d bytes) is not a proper suffix of the content", len(rest))
+			}
+			hasNote := false
+			for _, el := range card.Elements {
+				if el == interface{}(md(cardOverflowNote)) {
+					hasNote = true
+				}
+			}
+			if !hasNote {
+				t.Error("truncated card has no overflow note")
+			}
+		})
+	}
+}
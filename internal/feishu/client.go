@@ -4,35 +4,144 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"regexp"
+	"log/slog"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
-	"unicode"
 
 	lark "github.com/larksuite/oapi-sdk-go/v3"
 	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
 	"github.com/larksuite/oapi-sdk-go/v3/event/dispatcher"
 	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
 	larkws "github.com/larksuite/oapi-sdk-go/v3/ws"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vogo/moltbot-feishu/internal/metrics"
+	"github.com/vogo/moltbot-feishu/internal/tracing"
 )
 
 const (
 	SeenTTL = 10 * time.Minute
 )
 
+var tracer = tracing.Tracer("feishu")
+
+// InboundMessage 收到的用户消息
+type InboundMessage struct {
+	MessageID  string
+	ChatID     string
+	ChatType   string // p2p、group 或 topic_group
+	ChatName   string // 群名称, 私聊或查询失败时为空
+	SenderID   string // 发送者 open_id
+	SenderName string // 发送者姓名, 查询失败时为空
+	// 发送者 union_id 和直属部门的 open_department_id, 部门查询失败时为空
+	SenderUnionID     string
+	SenderDepartments []string
+	// SenderLookupFailed 表示查询发送者信息失败, 此时无法确定发送者的姓名和部门
+	SenderLookupFailed bool
+	RootID             string // 回复场景下的根消息 ID, 非回复消息为空
+	ThreadID           string // 所属话题 ID, 不在话题中为空
+	CreateTime         time.Time
+
+	Text string
+	// Attachments 为消息附带的图片和文件, 已下载完成
+	Attachments []Attachment
+	// Mentions 消息中提及的其他用户, 回复中的 @姓名 会转换为对他们的提及
+	Mentions []Mention
+}
+
+// Mention 被提及的用户
+type Mention struct {
+	Name   string
+	OpenID string
+}
+
+// ReplyFunc 回复回调，可多次调用，每次传入截至目前的完整回复
+// 第一次调用创建消息，后续调用更新消息; final 为 true 表示回复已结束, 卡片上的停止按钮随之移除
+type ReplyFunc func(text string, final bool) error
+
 // StreamHandler 流式消息处理器
-// reply 回调用于发送/更新回复，可多次调用
-// 第一次调用创建消息，后续调用更新消息
-type StreamHandler func(ctx context.Context, chatID, text string, reply func(text string) error) error
+type StreamHandler func(ctx context.Context, msg *InboundMessage, reply ReplyFunc) error
+
+// AccessHandler 在下载附件和转发消息之前判断消息是否允许处理
+// 此时发送者姓名、部门和群名称已补充, 附件尚未下载; 返回 false 时向用户回复 deniedText
+type AccessHandler func(ctx context.Context, msg *InboundMessage) (allowed bool, deniedText string)
+
+// CancelHandler 取消由指定消息触发的回复, 在用户点击停止按钮或撤回消息时调用
+// 返回 false 表示该消息没有进行中的回复
+type CancelHandler func(ctx context.Context, messageID string) bool
+
+// 回复渲染方式
+const (
+	RenderModeCard = "card" // markdown 渲染为消息卡片
+	RenderModeText = "text" // 纯文本消息
+)
+
+// 回复方式
+const (
+	ReplyToMessage = "message" // 引用触发消息回复
+	ReplyToThread  = "thread"  // 以触发消息为根在话题中回复
+	ReplyToChat    = "chat"    // 直接发送到会话
+)
+
+// 事件接收方式
+const (
+	EventModeWebSocket = "ws"      // WebSocket 长连接, 无需公网地址
+	EventModeWebhook   = "webhook" // HTTP 事件回调, 由飞书推送到配置的请求地址
+)
+
+// Options 客户端选项
+type Options struct {
+	// EventMode 事件接收方式, 为空时使用长连接
+	// Webhook 模式下 VerificationToken 用于校验请求来源, EncryptKey 不为空时校验签名并解密事件
+	EventMode         string
+	VerificationToken string
+	EncryptKey        string
+
+	// RenderMode 默认渲染方式, ChatRenderModes 按 chat_id 覆盖
+	RenderMode      string
+	ChatRenderModes map[string]string
+
+	// ReplyTo 回复方式: 引用触发消息回复、在话题中回复或直接发送到会话
+	ReplyTo string
+
+	// 文件附件限制: 大小上限 (字节) 和允许的扩展名 (小写, 不含点, 为空表示不限制)
+	MaxFileBytes     int64
+	AllowedFileTypes []string
+
+	// GroupPolicy 默认群聊响应策略, ChatGroupPolicies 按 chat_id 覆盖
+	GroupPolicy       GroupPolicy
+	ChatGroupPolicies map[string]GroupPolicy
+
+	// RedactLogs 为 true 时不输出 SDK 的 debug 日志, 其中包含完整的消息正文
+	RedactLogs bool
+}
 
 type Client struct {
 	appID     string
 	appSecret string
 	larkCli   *lark.Client
+	opts      Options
+
+	handler       StreamHandler
+	accessHandler AccessHandler
+	cancelHandler CancelHandler
+
+	// 事件分发器, 长连接和 Webhook 两种模式共用
+	events *dispatcher.EventDispatcher
+
+	// 用户和群信息缓存
+	dir *directory
+
+	// 长连接状态, 用于健康检查
+	monitor *connMonitor
 
-	handler StreamHandler
+	// 机器人自身的 open_id 和名称, 启动时获取
+	botOpenID string
+	botName   string
 
 	// 去重
 	seenMsgs    map[string]time.Time
@@ -43,41 +152,106 @@ type TextContent struct {
 	Text string `json:"text"`
 }
 
-func NewClient(appID, appSecret string) *Client {
+func NewClient(appID, appSecret string, opts Options) *Client {
+	// SDK 日志转发到 slog, 由 slog 按配置的级别过滤
 	cli := lark.NewClient(appID, appSecret,
-		lark.WithLogLevel(larkcore.LogLevelInfo),
+		lark.WithLogger(sdkLogger{redact: opts.RedactLogs}),
+		lark.WithLogLevel(larkcore.LogLevelDebug),
 	)
 
-	return &Client{
+	c := &Client{
 		appID:     appID,
 		appSecret: appSecret,
 		larkCli:   cli,
+		opts:      opts,
 		seenMsgs:  make(map[string]time.Time),
+		dir:       &directory{entries: make(map[string]cachedEntry)},
+		monitor:   newConnMonitor(sdkLogger{redact: opts.RedactLogs}),
 	}
+	c.events = c.newEventDispatcher()
+	return c
+}
+
+// newEventDispatcher 创建事件分发器并注册消息、撤回和卡片回调处理器
+// verificationToken 和 encryptKey 在长连接模式下为空
+func (c *Client) newEventDispatcher() *dispatcher.EventDispatcher {
+	eventDispatcher := dispatcher.NewEventDispatcher(c.opts.VerificationToken, c.opts.EncryptKey)
+
+	// 注册消息事件处理器
+	eventDispatcher.OnP2MessageReceiveV1(func(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
+		c.monitor.touch()
+		return c.handleMessage(ctx, event)
+	})
+
+	// 撤回触发消息时取消对应回复
+	eventDispatcher.OnP2MessageRecalledV1(func(ctx context.Context, event *larkim.P2MessageRecalledV1) error {
+		c.monitor.touch()
+		if event.Event != nil && event.Event.MessageId != nil && c.cancelHandler != nil {
+			c.cancelHandler(ctx, *event.Event.MessageId)
+		}
+		return nil
+	})
+
+	// 卡片停止按钮回调
+	eventDispatcher.OnP2CardActionTrigger(c.handleCardAction)
+	return eventDispatcher
 }
 
 func (c *Client) SetHandler(handler StreamHandler) {
 	c.handler = handler
 }
 
+// SetAccessHandler 设置访问控制处理器, 被拒绝的消息不会下载附件, 也不会交给消息处理器
+func (c *Client) SetAccessHandler(handler AccessHandler) {
+	c.accessHandler = handler
+}
+
+// SetCancelHandler 设置停止按钮和消息撤回时的取消处理器
+func (c *Client) SetCancelHandler(handler CancelHandler) {
+	c.cancelHandler = handler
+}
+
+// RenderModeFor 返回会话使用的回复渲染方式
+func (c *Client) RenderModeFor(chatID string) string {
+	if mode, ok := c.opts.ChatRenderModes[chatID]; ok {
+		return mode
+	}
+	if c.opts.RenderMode == "" {
+		return RenderModeCard
+	}
+	return c.opts.RenderMode
+}
+
 func (c *Client) Start(ctx context.Context) error {
-	// 创建事件分发器 (verificationToken 和 encryptKey 在 WebSocket 模式下可为空)
-	eventDispatcher := dispatcher.NewEventDispatcher("", "")
+	// 获取机器人自身信息, 失败时退化为任何 @ 提及都视为提及机器人
+	if err := c.loadBotInfo(ctx); err != nil {
+		slog.Warn("获取机器人信息失败, 群聊中任何 @ 提及都会触发回复", "error", err)
+	} else {
+		slog.Info("机器人信息", "name", c.botName, "open_id", c.botOpenID)
+	}
 
-	// 注册消息事件处理器
-	eventDispatcher.OnP2MessageReceiveV1(func(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
-		return c.handleMessage(ctx, event)
-	})
+	if c.opts.EventMode == EventModeWebhook {
+		return c.serveWebhook(ctx)
+	}
 
-	// 注意: SDK 没有 Stop 方法, 依赖 context 取消来退出
-	// 禁用 AutoReconnect 以便 context 取消时能快速退出
+	// 注意: SDK 没有 Stop 方法
 	wsClient := larkws.NewClient(c.appID, c.appSecret,
-		larkws.WithEventHandler(eventDispatcher),
-		larkws.WithLogLevel(larkcore.LogLevelInfo),
+		larkws.WithEventHandler(c.events),
+		larkws.WithLogger(c.monitor),
 	)
 
-	log.Println("正在连接飞书 WebSocket...")
-	return wsClient.Start(ctx)
+	// SDK 的 Start 在连接建立后永远阻塞 (即使 context 已取消), 放到后台运行,
+	// context 取消时直接返回, 让调用方完成关闭流程 (刷写限流计数、导出追踪数据等)
+	slog.Info("正在连接飞书 WebSocket")
+	errCh := make(chan error, 1)
+	go func() { errCh <- wsClient.Start(ctx) }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		c.monitor.setConnected(false)
+		return ctx.Err()
+	}
 }
 
 func (c *Client) Close() {
@@ -92,53 +266,138 @@ func (c *Client) handleMessage(ctx context.Context, event *larkim.P2MessageRecei
 	msg := event.Event.Message
 	msgID := *msg.MessageId
 
+	// 事件接收 span 作为整条消息处理链路的根, 后续 agent 运行和回复共用同一 trace
+	ctx, span := tracer.Start(ctx, "feishu.receive_message",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("message_id", msgID),
+			attribute.String("chat_id", stringValue(msg.ChatId)),
+			attribute.String("chat_type", stringValue(msg.ChatType)),
+			attribute.String("msg_type", stringValue(msg.MessageType)),
+		))
+	defer span.End()
+	if ms, err := strconv.ParseInt(stringValue(msg.CreateTime), 10, 64); err == nil {
+		// 消息发送到收到事件的延迟, 用于判断飞书事件投递是否变慢
+		span.SetAttributes(attribute.Int64("delivery_delay_ms", time.Since(time.UnixMilli(ms)).Milliseconds()))
+	}
+
 	// 去重检查
-	if c.isDuplicate(msgID) {
+	_, dedupeSpan := tracer.Start(ctx, "feishu.dedupe")
+	duplicate := c.isDuplicate(msgID)
+	dedupeSpan.SetAttributes(attribute.Bool("duplicate", duplicate))
+	dedupeSpan.End()
+	if duplicate {
+		metrics.DuplicatesDropped.Inc()
 		return nil
 	}
 
-	// 只处理文本消息
-	if msg.MessageType == nil || *msg.MessageType != "text" {
+	// 解析消息内容, 只处理文本、富文本、图片和文件消息
+	if msg.MessageType == nil || msg.Content == nil {
 		return nil
 	}
-
-	// 解析消息内容
-	var content TextContent
-	if err := json.Unmarshal([]byte(*msg.Content), &content); err != nil {
-		log.Printf("解析消息内容失败: %v", err)
+	metrics.MessagesReceived.WithLabelValues(stringValue(msg.ChatType), *msg.MessageType).Inc()
+	text, refs, err := parseContent(*msg.MessageType, *msg.Content)
+	if err != nil {
+		slog.Warn("解析消息内容失败", "message_id", msgID, "error", err)
 		return nil
 	}
-
-	text := content.Text
-	if text == "" {
+	if text == "" && len(refs) == 0 {
 		return nil
 	}
 
 	chatID := *msg.ChatId
-	chatType := ""
-	if msg.ChatType != nil {
-		chatType = *msg.ChatType
-	}
+	chatType := stringValue(msg.ChatType)
 
-	// 群聊智能过滤
+	// 移除对机器人的 @ 提及, 其他提及替换为姓名; 群聊按响应策略过滤
+	mentions := event.Event.Message.Mentions
+	text = c.resolveMentions(text, mentions)
 	if chatType == "group" {
-		if !c.shouldRespondInGroup(text, event.Event.Message.Mentions) {
+		_, policySpan := tracer.Start(ctx, "feishu.group_policy")
+		respond := c.shouldRespondInGroup(chatID, text, c.mentionsBot(mentions))
+		policySpan.SetAttributes(
+			attribute.String("policy", c.groupPolicyFor(chatID).Mode),
+			attribute.Bool("respond", respond),
+		)
+		policySpan.End()
+		if !respond {
+			metrics.MessagesFiltered.Inc()
 			return nil
 		}
 	}
-
-	// 移除 @ 提及
-	text = c.stripMentions(text)
-	if text == "" {
+	if text == "" && len(refs) == 0 {
 		return nil
 	}
 
+	inbound := &InboundMessage{
+		MessageID: msgID,
+		ChatID:    chatID,
+		ChatType:  chatType,
+		RootID:    stringValue(msg.RootId),
+		ThreadID:  stringValue(msg.ThreadId),
+		Text:      text,
+		Mentions:  c.mentionedUsers(mentions),
+	}
+	if sender := event.Event.Sender; sender != nil && sender.SenderId != nil {
+		inbound.SenderID = stringValue(sender.SenderId.OpenId)
+		inbound.SenderUnionID = stringValue(sender.SenderId.UnionId)
+	}
+	if ms, err := strconv.ParseInt(stringValue(msg.CreateTime), 10, 64); err == nil {
+		inbound.CreateTime = time.UnixMilli(ms)
+	} else {
+		inbound.CreateTime = time.Now()
+	}
+
 	// 异步处理消息
-	go c.processMessage(ctx, chatID, text)
+	go c.processMessage(ctx, inbound, refs)
 
 	return nil
 }
 
+func stringValue(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// parseContent 提取消息中的文本和引用的资源, 不支持的消息类型返回空结果
+func parseContent(msgType, content string) (string, []resourceRef, error) {
+	switch msgType {
+	case larkim.MsgTypeText:
+		var tc TextContent
+		if err := json.Unmarshal([]byte(content), &tc); err != nil {
+			return "", nil, err
+		}
+		return tc.Text, nil, nil
+	case larkim.MsgTypePost:
+		post, err := parsePost(content)
+		if err != nil {
+			return "", nil, err
+		}
+		return flattenPost(post), postImages(post), nil
+	case larkim.MsgTypeImage:
+		var ic ImageContent
+		if err := json.Unmarshal([]byte(content), &ic); err != nil {
+			return "", nil, err
+		}
+		if ic.ImageKey == "" {
+			return "", nil, nil
+		}
+		return "", []resourceRef{{Key: ic.ImageKey, Type: "image"}}, nil
+	case larkim.MsgTypeFile:
+		var fc FileContent
+		if err := json.Unmarshal([]byte(content), &fc); err != nil {
+			return "", nil, err
+		}
+		if fc.FileKey == "" {
+			return "", nil, nil
+		}
+		return "", []resourceRef{{Key: fc.FileKey, Type: "file", Name: fc.FileName}}, nil
+	default:
+		return "", nil, nil
+	}
+}
+
 func (c *Client) isDuplicate(msgID string) bool {
 	c.seenMsgLock.Lock()
 	defer c.seenMsgLock.Unlock()
@@ -159,95 +418,225 @@ func (c *Client) isDuplicate(msgID string) bool {
 	return false
 }
 
-func (c *Client) shouldRespondInGroup(text string, mentions []*larkim.MentionEvent) bool {
-	// 被 @ 了
-	if len(mentions) > 0 {
-		return true
+func (c *Client) processMessage(ctx context.Context, msg *InboundMessage, refs []resourceRef) {
+	if c.handler == nil {
+		slog.Error("未设置消息处理器")
+		return
 	}
-
-	// 以问号结尾
-	text = strings.TrimSpace(text)
-	if strings.HasSuffix(text, "?") || strings.HasSuffix(text, "？") {
-		return true
+	chatID, msgID := msg.ChatID, msg.MessageID
+
+	ctx, span := tracer.Start(ctx, "feishu.process_message", trace.WithAttributes(
+		attribute.String("message_id", msgID),
+		attribute.String("chat_id", chatID),
+	))
+	defer span.End()
+
+	// 补充发送者姓名、部门和群名称, 发送者也可以在回复中被 @
+	user, err := c.userInfo(ctx, msg.SenderID)
+	msg.SenderName, msg.SenderDepartments, msg.SenderLookupFailed = user.Name, user.DepartmentIDs, err != nil
+	if msg.ChatType != "p2p" {
+		msg.ChatName = c.chatName(ctx, chatID)
 	}
 
-	lowerText := strings.ToLower(text)
-
-	// 英文疑问词
-	questionWords := []string{"why", "how", "what", "when", "where", "who", "help"}
-	for _, word := range questionWords {
-		if strings.Contains(lowerText, word) {
-			return true
+	// 访问控制先于下载附件, 被拒绝的用户只会收到拒绝提示
+	if c.accessHandler != nil {
+		if allowed, deniedText := c.accessHandler(ctx, msg); !allowed {
+			if _, err := c.sendMessage(ctx, chatID, msgID, deniedText); err != nil {
+				slog.Warn("发送拒绝提示失败", "chat_id", chatID, "message_id", msgID, "error", err)
+			}
+			return
 		}
 	}
 
-	// 中文请求动词
-	chineseVerbs := []string{"帮", "麻烦", "请", "能否", "可以", "解释", "看看", "排查", "分析", "总结", "写", "改", "修", "查", "对比", "翻译"}
-	for _, verb := range chineseVerbs {
-		if strings.Contains(text, verb) {
-			return true
-		}
+	// 下载消息附带的资源, 未能处理的附件提示用户
+	attachments, failures := c.downloadAttachments(ctx, msgID, refs)
+	if len(failures) > 0 {
+		c.sendMessage(ctx, chatID, msgID, "以下附件未能处理:\n"+strings.Join(failures, "\n"))
 	}
-
-	// 以机器人名称开头
-	botNames := []string{"alen", "moltbot", "bot", "助手", "智能体"}
-	for _, name := range botNames {
-		if strings.HasPrefix(lowerText, name) {
-			return true
+	if msg.Text == "" {
+		if len(attachments) == 0 {
+			return
+		}
+		names := make([]string, 0, len(attachments))
+		for _, att := range attachments {
+			names = append(names, describeRef(resourceRef{Type: att.Type, Name: att.FileName}))
 		}
+		msg.Text = strings.Join(names, " ")
 	}
+	msg.Attachments = attachments
 
-	return false
-}
-
-func (c *Client) stripMentions(text string) string {
-	// 移除 @_user_xxx 格式的提及
-	re := regexp.MustCompile(`@_user_\d+\s*`)
-	text = re.ReplaceAllString(text, "")
-	return strings.TrimFunc(text, unicode.IsSpace)
-}
-
-func (c *Client) processMessage(ctx context.Context, chatID, text string) {
-	if c.handler == nil {
-		log.Println("未设置消息处理器")
-		return
+	mentionable := msg.Mentions
+	if msg.SenderName != "" {
+		mentionable = append([]Mention{{Name: msg.SenderName, OpenID: msg.SenderID}}, mentionable...)
 	}
 
-	// 创建回复回调 - 每次调用发送一条新消息
-	replyFunc := func(content string) error {
+	// 创建回复回调 - 第一次调用发送消息, 后续调用原地更新该消息
+	// 卡片通过 Patch 更新, 文本消息通过编辑更新; 卡片发送或更新失败时降级为文本,
+	// 降级后不再发送中间结果 (文本消息的编辑次数有限), 只在结束时发送完整回复
+	// 未结束的卡片带有停止按钮
+	var replyMsgID, lastContent string
+	var lastFinal, overflowSent, fellBack bool
+	var lastCard *Card
+	useCard := c.RenderModeFor(chatID) == RenderModeCard
+	replyFunc := func(content string, final bool) (err error) {
 		content = strings.TrimSpace(content)
 		if content == "" {
 			return nil
 		}
-		_, err := c.sendMessage(ctx, chatID, content)
-		return err
+		if replyMsgID != "" && content == lastContent && (final == lastFinal || !useCard) {
+			return nil
+		}
+		if fellBack && !final {
+			return nil
+		}
+		lastContent, lastFinal = content, final
+
+		ctx, span := tracer.Start(ctx, "feishu.send_reply", trace.WithAttributes(
+			attribute.Bool("final", final),
+			attribute.Bool("update", replyMsgID != ""),
+			attribute.Int("content_length", len(content)),
+		))
+		defer func() { tracing.End(span, err) }()
+
+		// 超出卡片上限的内容在卡片中截断, 结束时剩余部分以文本消息发送
+		var rest string
+		card := func() *Card {
+			var card *Card
+			card, rest = buildReplyCard(content, mentionable, msgID, final)
+			return card
+		}
+		sendOverflow := func() error {
+			if !final || rest == "" || overflowSent {
+				return nil
+			}
+			overflowSent = true
+			_, err := c.sendMessage(ctx, chatID, msgID, linkMentions(rest, mentionable))
+			return err
+		}
+
+		if replyMsgID != "" && !fellBack {
+			if !useCard {
+				return c.updateMessage(ctx, replyMsgID, linkMentions(content, mentionable))
+			}
+			next := card()
+			err := c.patchCard(ctx, replyMsgID, next)
+			if err == nil {
+				lastCard = next
+				return sendOverflow()
+			}
+			slog.Warn("更新卡片失败, 改用文本消息", "chat_id", chatID, "message_id", msgID, "error", err)
+			useCard, fellBack = false, true
+			// 保留上一次成功的卡片内容, 移除停止按钮, 避免留下仍可点击的旧卡片
+			if lastCard != nil {
+				if err := c.patchCard(ctx, replyMsgID, withoutStopButton(lastCard, cardFallbackNote)); err != nil {
+					slog.Warn("移除卡片停止按钮失败", "chat_id", chatID, "message_id", msgID, "error", err)
+				}
+			}
+			if !final {
+				return nil
+			}
+		} else if useCard && !fellBack {
+			next := card()
+			newID, err := c.sendCard(ctx, chatID, msgID, next)
+			if err == nil {
+				replyMsgID, lastCard = newID, next
+				return sendOverflow()
+			}
+			slog.Warn("发送卡片失败, 改用文本消息", "chat_id", chatID, "message_id", msgID, "error", err)
+			useCard, fellBack = false, true
+			if !final {
+				return nil
+			}
+		}
+
+		newID, err := c.sendMessage(ctx, chatID, msgID, linkMentions(content, mentionable))
+		if err != nil {
+			return err
+		}
+		replyMsgID = newID
+		return nil
 	}
 
 	// 调用流式处理器
-	if err := c.handler(ctx, chatID, text, replyFunc); err != nil {
-		log.Printf("处理消息失败: %v", err)
-		c.sendMessage(ctx, chatID, fmt.Sprintf("处理消息时发生错误: %v", err))
+	if err := c.handler(ctx, msg, replyFunc); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		slog.Error("处理消息失败", "chat_id", chatID, "message_id", msgID, "error", err)
+		c.sendMessage(ctx, chatID, msgID, fmt.Sprintf("处理消息时发生错误: %v", err))
 	}
 }
 
-func (c *Client) sendMessage(ctx context.Context, chatID, text string) (string, error) {
+// sendMessage 发送文本消息, replyTo 为触发回复的消息 ID
+func (c *Client) sendMessage(ctx context.Context, chatID, replyTo, text string) (string, error) {
 	content, _ := json.Marshal(TextContent{Text: text})
+	return c.deliver(ctx, chatID, replyTo, larkim.MsgTypeText, string(content))
+}
+
+// deliver 按配置的回复方式发送消息, 返回消息 ID
+// 回复失败 (如触发消息已撤回) 时改为直接发送到会话
+func (c *Client) deliver(ctx context.Context, chatID, replyTo, msgType, content string) (string, error) {
+	if replyTo == "" || c.opts.ReplyTo == ReplyToChat {
+		return c.createMessage(ctx, chatID, msgType, content)
+	}
+
+	msgID, err := c.replyMessage(ctx, replyTo, msgType, content, c.opts.ReplyTo == ReplyToThread)
+	if err == nil {
+		return msgID, nil
+	}
+	slog.Warn("回复消息失败, 改为直接发送", "chat_id", chatID, "message_id", replyTo, "error", err)
+	return c.createMessage(ctx, chatID, msgType, content)
+}
+
+// replyMessage 引用指定消息回复, inThread 为 true 时在话题中回复
+func (c *Client) replyMessage(ctx context.Context, replyTo, msgType, content string, inThread bool) (string, error) {
+	ctx, span := tracer.Start(ctx, "feishu.reply_message", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("message_id", replyTo), attribute.String("msg_type", msgType)))
+	defer span.End()
+
+	req := larkim.NewReplyMessageReqBuilder().
+		MessageId(replyTo).
+		Body(larkim.NewReplyMessageReqBodyBuilder().
+			MsgType(msgType).
+			Content(content).
+			ReplyInThread(inThread).
+			Build()).
+		Build()
+
+	resp, err := c.larkCli.Im.V1.Message.Reply(ctx, req)
+	if err != nil {
+		return "", sendFailed(span, "reply", err)
+	}
+	if !resp.Success() {
+		return "", sendFailed(span, "reply", fmt.Errorf("回复消息失败: %s", resp.Msg))
+	}
+
+	if resp.Data != nil && resp.Data.MessageId != nil {
+		return *resp.Data.MessageId, nil
+	}
+	return "", nil
+}
+
+// createMessage 向会话发送一条指定类型的消息, 返回消息 ID
+func (c *Client) createMessage(ctx context.Context, chatID, msgType, content string) (string, error) {
+	ctx, span := tracer.Start(ctx, "feishu.create_message", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("chat_id", chatID), attribute.String("msg_type", msgType)))
+	defer span.End()
 
 	req := larkim.NewCreateMessageReqBuilder().
 		ReceiveIdType(larkim.ReceiveIdTypeChatId).
 		Body(larkim.NewCreateMessageReqBodyBuilder().
 			ReceiveId(chatID).
-			MsgType(larkim.MsgTypeText).
-			Content(string(content)).
+			MsgType(msgType).
+			Content(content).
 			Build()).
 		Build()
 
 	resp, err := c.larkCli.Im.V1.Message.Create(ctx, req)
 	if err != nil {
-		return "", err
+		return "", sendFailed(span, "create", err)
 	}
 	if !resp.Success() {
-		return "", fmt.Errorf("发送消息失败: %s", resp.Msg)
+		return "", sendFailed(span, "create", fmt.Errorf("发送消息失败: %s", resp.Msg))
 	}
 
 	if resp.Data != nil && resp.Data.MessageId != nil {
@@ -256,3 +645,36 @@ func (c *Client) sendMessage(ctx context.Context, chatID, text string) (string,
 	return "", nil
 }
 
+// updateMessage 编辑已发送的文本消息
+func (c *Client) updateMessage(ctx context.Context, msgID, text string) error {
+	ctx, span := tracer.Start(ctx, "feishu.update_message", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("message_id", msgID)))
+	defer span.End()
+
+	content, _ := json.Marshal(TextContent{Text: text})
+
+	req := larkim.NewUpdateMessageReqBuilder().
+		MessageId(msgID).
+		Body(larkim.NewUpdateMessageReqBodyBuilder().
+			MsgType(larkim.MsgTypeText).
+			Content(string(content)).
+			Build()).
+		Build()
+
+	resp, err := c.larkCli.Im.V1.Message.Update(ctx, req)
+	if err != nil {
+		return sendFailed(span, "update", err)
+	}
+	if !resp.Success() {
+		return sendFailed(span, "update", fmt.Errorf("编辑消息失败: %s", resp.Msg))
+	}
+	return nil
+}
+
+// sendFailed 记录消息接口调用失败并标记 span, 原样返回错误
+func sendFailed(span trace.Span, api string, err error) error {
+	metrics.FeishuSendFailures.WithLabelValues(api).Inc()
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
@@ -0,0 +1,137 @@
+package feishu
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	larkcontact "github.com/larksuite/oapi-sdk-go/v3/service/contact/v3"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// 用户和群信息的缓存时间, 查询失败的结果不缓存, 下一条消息重新查询
+const directoryTTL = time.Hour
+
+// UserInfo 通讯录中的用户信息
+type UserInfo struct {
+	Name string
+	// DepartmentIDs 为所属部门的 open_department_id, 需要 contact:user.department:readonly 权限
+	DepartmentIDs []string
+}
+
+type cachedEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// directory 缓存用户和群信息
+type directory struct {
+	entries map[string]cachedEntry
+	mu      sync.Mutex
+}
+
+// lookup 返回缓存的信息, 过期或不存在时调用 fetch 获取并缓存
+// 查询失败时返回 fetch 的结果和错误, 不写入缓存
+func (d *directory) lookup(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	d.mu.Lock()
+	if entry, ok := d.entries[key]; ok && time.Now().Before(entry.expires) {
+		d.mu.Unlock()
+		return entry.value, nil
+	}
+	d.mu.Unlock()
+
+	value, err := fetch()
+	if err != nil {
+		slog.Warn("查询通讯录失败", "key", key, "error", err)
+		return value, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for k, entry := range d.entries {
+		if now.After(entry.expires) {
+			delete(d.entries, k)
+		}
+	}
+	d.entries[key] = cachedEntry{value: value, expires: now.Add(directoryTTL)}
+	return value, nil
+}
+
+// userInfo 通过通讯录接口查询用户信息, 需要 contact:user.base:readonly 权限
+// 查询失败时返回空信息和错误
+func (c *Client) userInfo(ctx context.Context, openID string) (UserInfo, error) {
+	if openID == "" {
+		return UserInfo{}, nil
+	}
+	value, err := c.dir.lookup("user:"+openID, func() (interface{}, error) {
+		req := larkcontact.NewGetUserReqBuilder().
+			UserId(openID).
+			UserIdType(larkcontact.UserIdTypeOpenId).
+			DepartmentIdType(larkcontact.DepartmentIdTypeOpenDepartmentId).
+			Build()
+		resp, err := c.larkCli.Contact.V3.User.Get(ctx, req)
+		if err != nil {
+			return UserInfo{}, err
+		}
+		if !resp.Success() {
+			return UserInfo{}, fmt.Errorf("查询用户失败: %s", resp.Msg)
+		}
+		if resp.Data == nil || resp.Data.User == nil {
+			return UserInfo{}, nil
+		}
+		return UserInfo{
+			Name:          stringValue(resp.Data.User.Name),
+			DepartmentIDs: resp.Data.User.DepartmentIds,
+		}, nil
+	})
+	return value.(UserInfo), err
+}
+
+// chatName 查询群名称, 查询失败时返回空字符串
+func (c *Client) chatName(ctx context.Context, chatID string) string {
+	value, _ := c.dir.lookup("chat:"+chatID, func() (interface{}, error) {
+		req := larkim.NewGetChatReqBuilder().ChatId(chatID).Build()
+		resp, err := c.larkCli.Im.V1.Chat.Get(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		if !resp.Success() {
+			return "", fmt.Errorf("查询群信息失败: %s", resp.Msg)
+		}
+		if resp.Data == nil {
+			return "", nil
+		}
+		return stringValue(resp.Data.Name), nil
+	})
+	return value.(string)
+}
+
+// MissingScopes 返回应用尚未获得授权的权限, 用于启动时提示缺少的通讯录权限
+func (c *Client) MissingScopes(ctx context.Context, scopes ...string) ([]string, error) {
+	resp, err := c.larkCli.Application.V6.Scope.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success() {
+		return nil, fmt.Errorf("查询应用权限失败: %s", resp.Msg)
+	}
+	granted := make(map[string]bool)
+	if resp.Data != nil {
+		for _, scope := range resp.Data.Scopes {
+			// grant_status 为 1 表示已授权
+			if scope != nil && scope.GrantStatus != nil && *scope.GrantStatus == 1 {
+				granted[stringValue(scope.ScopeName)] = true
+			}
+		}
+	}
+	var missing []string
+	for _, scope := range scopes {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,97 @@
+package feishu
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+)
+
+// ConnState 飞书事件接收状态
+// Webhook 模式下没有长连接, Connected 表示事件回调已就绪
+type ConnState struct {
+	Mode        string
+	Connected   bool
+	Reconnects  int       // 首次连接之后重新建立连接的次数
+	LastEventAt time.Time // 最近一次收到事件的时间, 尚未收到时为零值
+}
+
+// connMonitor 记录长连接状态
+// SDK 没有提供连接状态接口, 因此包装 SDK 日志, 根据建立和断开连接的日志推断状态
+type connMonitor struct {
+	next larkcore.Logger
+
+	connects  int
+	connected bool
+	lastEvent time.Time
+	mu        sync.Mutex
+}
+
+func newConnMonitor(next larkcore.Logger) *connMonitor {
+	return &connMonitor{next: next}
+}
+
+func (m *connMonitor) Debug(ctx context.Context, args ...interface{}) {
+	m.next.Debug(ctx, args...)
+}
+
+func (m *connMonitor) Info(ctx context.Context, args ...interface{}) {
+	if len(args) > 0 {
+		msg := fmt.Sprint(args[0])
+		m.mu.Lock()
+		switch {
+		case strings.HasPrefix(msg, "connected to "):
+			m.connects++
+			m.connected = true
+		case strings.HasPrefix(msg, "disconnected to "):
+			m.connected = false
+		}
+		m.mu.Unlock()
+	}
+	m.next.Info(ctx, args...)
+}
+
+func (m *connMonitor) Warn(ctx context.Context, args ...interface{}) {
+	m.next.Warn(ctx, args...)
+}
+
+func (m *connMonitor) Error(ctx context.Context, args ...interface{}) {
+	m.next.Error(ctx, args...)
+}
+
+// setConnected 设置连接状态, 用于没有长连接日志的 Webhook 模式
+func (m *connMonitor) setConnected(connected bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connected = connected
+}
+
+// touch 记录收到事件的时间
+func (m *connMonitor) touch() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastEvent = time.Now()
+}
+
+func (m *connMonitor) state() ConnState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return ConnState{
+		Connected:   m.connected,
+		Reconnects:  max(m.connects-1, 0),
+		LastEventAt: m.lastEvent,
+	}
+}
+
+// ConnState 返回飞书事件接收的当前状态
+func (c *Client) ConnState() ConnState {
+	state := c.monitor.state()
+	state.Mode = c.opts.EventMode
+	if state.Mode == "" {
+		state.Mode = EventModeWebSocket
+	}
+	return state
+}
@@ -0,0 +1,43 @@
+package feishu
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+)
+
+// sdkLogger 将飞书 SDK 的日志转发到 slog, 级别过滤由 slog 处理
+// SDK 的 debug 日志包含完整的事件和请求体 (消息正文), redact 为 true 时丢弃
+type sdkLogger struct {
+	redact bool
+}
+
+var _ larkcore.Logger = sdkLogger{}
+
+func (l sdkLogger) Debug(ctx context.Context, args ...interface{}) {
+	if !l.redact {
+		logSDK(ctx, slog.LevelDebug, args)
+	}
+}
+
+func (sdkLogger) Info(ctx context.Context, args ...interface{})  { logSDK(ctx, slog.LevelInfo, args) }
+func (sdkLogger) Warn(ctx context.Context, args ...interface{})  { logSDK(ctx, slog.LevelWarn, args) }
+func (sdkLogger) Error(ctx context.Context, args ...interface{}) { logSDK(ctx, slog.LevelError, args) }
+
+func logSDK(ctx context.Context, level slog.Level, args []interface{}) {
+	slog.Log(ctx, level, sdkMessage(args), "component", "lark")
+}
+
+// urlQueryPattern 匹配日志中 URL 的查询参数
+var urlQueryPattern = regexp.MustCompile(`(\b[a-z][a-z0-9+.\-]*://[^\s?#]+)\?[^\s#]*`)
+
+// sdkMessage 拼接 SDK 日志参数, 去掉 URL 的查询参数
+// 长连接地址的查询参数中带有 access_key、ticket 等连接凭证, 无论是否开启脱敏都不输出
+func sdkMessage(args []interface{}) string {
+	msg := strings.TrimSpace(fmt.Sprintln(args...))
+	return urlQueryPattern.ReplaceAllString(msg, "$1")
+}
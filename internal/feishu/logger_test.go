@@ -0,0 +1,51 @@
+package feishu
+
+import "testing"
+
+func TestSDKMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []interface{}
+		want string
+	}{
+		{
+			// larkws 建立连接时的日志, 参数为 fmtLog 的输出
+			name: "ws connected",
+			args: []interface{}{
+				"connected to wss://msg-frontier.feishu.cn/ws/v2?fpid=493&aid=552564&device_id=7412345678901234567&access_key=3f1b0c2d9e8a7f6b5c4d3e2f1a0b9c8d&service_id=33554678&ticket=0b3c2d1e-4f5a-6b7c-8d9e-0f1a2b3c4d5e",
+				"[conn_id=7412345678901234567]",
+			},
+			want: "connected to wss://msg-frontier.feishu.cn/ws/v2 [conn_id=7412345678901234567]",
+		},
+		{
+			name: "ws disconnected",
+			args: []interface{}{
+				"disconnected to wss://msg-frontier.feishu.cn/ws/v2?fpid=493&access_key=3f1b0c2d&ticket=0b3c2d1e#frag",
+				"[conn_id=7412345678901234567]",
+			},
+			want: "disconnected to wss://msg-frontier.feishu.cn/ws/v2#frag [conn_id=7412345678901234567]",
+		},
+		{
+			name: "no query",
+			args: []interface{}{"connected to wss://msg-frontier.feishu.cn/ws/v2"},
+			want: "connected to wss://msg-frontier.feishu.cn/ws/v2",
+		},
+		{
+			name: "plain text",
+			args: []interface{}{"trying to reconnect: 2", "[conn_id=1]"},
+			want: "trying to reconnect: 2 [conn_id=1]",
+		},
+		{
+			name: "question mark outside url",
+			args: []interface{}{"receive unknown message, message_type: 9, message: why?"},
+			want: "receive unknown message, message_type: 9, message: why?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sdkMessage(tt.args); got != tt.want {
+				t.Errorf("sdkMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
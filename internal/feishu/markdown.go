@@ -0,0 +1,166 @@
+package feishu
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	ruleRe      = regexp.MustCompile(`^(\*{3,}|-{3,}|_{3,})$`)
+	tableSepRe  = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+	bulletRe    = regexp.MustCompile(`^(\s*)[*+]\s+`)
+	imageRe     = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	htmlEscaper = strings.NewReplacer("<", "&lt;", ">", "&gt;")
+)
+
+// renderCard 将 agent 回复的 markdown 渲染为消息卡片
+// 卡片 markdown 组件只支持 markdown 的子集, 这里将其余语法转换为等价组件:
+// 标题转为加粗行, 代码块独立成组件, 分割线转为 hr, 表格转为分栏
+// 回复文本全部转义后, 只有 users 中的 @姓名 会转换为提及标签
+func renderCard(md string, users []Mention) *Card {
+	mentions := mentionReplacer(users, true)
+	card := &Card{
+		Config: CardConfig{WideScreenMode: true, UpdateMulti: true},
+	}
+
+	var para []string
+	flushPara := func() {
+		text := strings.Trim(strings.Join(para, "\n"), "\n")
+		if strings.TrimSpace(text) != "" {
+			card.Elements = append(card.Elements, MarkdownElement{Tag: "markdown", Content: text})
+		}
+		para = para[:0]
+	}
+
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flushPara()
+			var code []string
+			code, i = readCodeBlock(lines, i)
+			card.Elements = append(card.Elements, MarkdownElement{Tag: "markdown", Content: strings.Join(code, "\n")})
+
+		case headingRe.MatchString(trimmed):
+			m := headingRe.FindStringSubmatch(trimmed)
+			para = append(para, "**"+renderInline(m[2], mentions)+"**")
+
+		case ruleRe.MatchString(trimmed):
+			flushPara()
+			card.Elements = append(card.Elements, HrElement{Tag: "hr"})
+
+		case strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && tableSepRe.MatchString(strings.TrimSpace(lines[i+1])):
+			flushPara()
+			var rows [][]string
+			rows, i = readTable(lines, i)
+			card.Elements = append(card.Elements, renderTable(rows, mentions)...)
+
+		default:
+			para = append(para, renderInline(bulletRe.ReplaceAllString(line, "$1- "), mentions))
+		}
+	}
+	flushPara()
+
+	if len(card.Elements) == 0 {
+		card.Elements = append(card.Elements, MarkdownElement{Tag: "markdown", Content: " "})
+	}
+	return card
+}
+
+// readCodeBlock 读取从 start 开始的围栏代码块, 返回带围栏的代码行和最后一行的下标
+// 未闭合的代码块 (流式输出中途) 视为延续到结尾
+func readCodeBlock(lines []string, start int) ([]string, int) {
+	open := strings.TrimSpace(lines[start])
+	fence := open[:3]
+	lang := strings.TrimSpace(strings.TrimLeft(open, fence[:1]))
+
+	code := []string{"```" + lang}
+	i := start + 1
+	for ; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+			break
+		}
+		code = append(code, lines[i])
+	}
+	code = append(code, "```")
+	if i >= len(lines) {
+		i = len(lines) - 1
+	}
+	return code, i
+}
+
+// readTable 读取从 start 开始的表格 (表头、分隔行、数据行), 返回各行单元格和最后一行的下标
+func readTable(lines []string, start int) ([][]string, int) {
+	rows := [][]string{splitTableRow(lines[start])}
+	i := start + 2
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "|") {
+			break
+		}
+		rows = append(rows, splitTableRow(trimmed))
+	}
+	return rows, i - 1
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = strings.TrimSpace(cell)
+	}
+	return cells
+}
+
+// renderTable 将表格渲染为分栏, 每行一个 column_set, 表头加粗并使用灰色背景
+func renderTable(rows [][]string, mentions *strings.Replacer) []interface{} {
+	cols := len(rows[0])
+	elements := make([]interface{}, 0, len(rows))
+	for r, row := range rows {
+		set := ColumnSetElement{
+			Tag:             "column_set",
+			FlexMode:        "none",
+			BackgroundStyle: "default",
+		}
+		if r == 0 {
+			set.BackgroundStyle = "grey"
+		}
+		for c := 0; c < cols; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = renderInline(row[c], mentions)
+			}
+			if r == 0 && cell != "" {
+				cell = "**" + cell + "**"
+			}
+			if cell == "" {
+				cell = " "
+			}
+			set.Columns = append(set.Columns, ColumnElement{
+				Tag:           "column",
+				Width:         "weighted",
+				Weight:        1,
+				VerticalAlign: "top",
+				Elements:      []interface{}{MarkdownElement{Tag: "markdown", Content: cell}},
+			})
+		}
+		elements = append(elements, set)
+	}
+	return elements
+}
+
+// renderInline 处理行内语法: 转义尖括号后将 @姓名 转换为提及标签 (行内代码除外), 图片转为链接 (卡片图片需要先上传)
+func renderInline(text string, mentions *strings.Replacer) string {
+	parts := strings.Split(text, "`")
+	for i := 0; i < len(parts); i += 2 {
+		parts[i] = mentions.Replace(htmlEscaper.Replace(parts[i]))
+	}
+	text = strings.Join(parts, "`")
+	return imageRe.ReplaceAllString(text, "[$1]($2)")
+}
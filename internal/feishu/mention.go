@@ -0,0 +1,98 @@
+package feishu
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// atTagRe 匹配文本中的飞书提及标签开头, 如 <at user_id="all">
+// agent 回复中自带的提及标签 (可能来自提示词注入) 不能生效, 否则可以 @所有人
+var atTagRe = regexp.MustCompile(`(?i)<(/?)at\b`)
+
+// resolveMentions 处理文本中的 @_user_N 占位符: 对机器人的提及移除, 对其他人的提及替换为 @姓名
+func (c *Client) resolveMentions(text string, mentions []*larkim.MentionEvent) string {
+	for _, mention := range mentions {
+		if mention.Key == nil {
+			continue
+		}
+		replacement := ""
+		if !c.isBotMention(mention) {
+			if name := stringValue(mention.Name); name != "" {
+				replacement = "@" + name + " "
+			} else {
+				replacement = *mention.Key + " "
+			}
+		}
+		// 占位符按整词匹配, 避免 @_user_1 误伤 @_user_10
+		re := regexp.MustCompile(regexp.QuoteMeta(*mention.Key) + `\b\s*`)
+		text = re.ReplaceAllLiteralString(text, replacement)
+	}
+	return strings.TrimFunc(text, unicode.IsSpace)
+}
+
+// mentionedUsers 返回消息中提及的用户 (不含机器人)
+func (c *Client) mentionedUsers(mentions []*larkim.MentionEvent) []Mention {
+	var users []Mention
+	for _, mention := range mentions {
+		if c.isBotMention(mention) || mention.Id == nil {
+			continue
+		}
+		name, openID := stringValue(mention.Name), stringValue(mention.Id.OpenId)
+		if name != "" && openID != "" {
+			users = append(users, Mention{Name: name, OpenID: openID})
+		}
+	}
+	return users
+}
+
+// mentionReplacer 返回将 @姓名 替换为提及标签的 Replacer, 只包含已知 open_id 的用户
+// card 为 true 时使用卡片 markdown 的提及格式, 此时待替换的文本已转义, 姓名同样按转义后匹配
+func mentionReplacer(users []Mention, card bool) *strings.Replacer {
+	// 长名字优先, 避免 @Alice 被 @Al 截断
+	users = append([]Mention(nil), users...)
+	sort.Slice(users, func(i, j int) bool { return len(users[i].Name) > len(users[j].Name) })
+	pairs := make([]string, 0, len(users)*2)
+	for _, user := range users {
+		if user.Name == "" || user.OpenID == "" {
+			continue
+		}
+		if card {
+			pairs = append(pairs, "@"+htmlEscaper.Replace(user.Name), fmt.Sprintf("<at id=%s></at>", user.OpenID))
+		} else {
+			pairs = append(pairs, "@"+user.Name, fmt.Sprintf(`<at user_id="%s">%s</at>`, user.OpenID, user.Name))
+		}
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// linkMentions 将文本消息回复中的 @姓名 转换为飞书提及标签, 代码块中的内容保持不变
+// 回复中自带的提及标签先被破坏, 只有 users 中的用户会被提及; 卡片的提及由 renderCard 处理
+func linkMentions(text string, users []Mention) string {
+	text = atTagRe.ReplaceAllString(text, "<\u200b${1}at")
+	replacer := mentionReplacer(users, false)
+
+	lines := strings.Split(text, "\n")
+	inCode := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		// 跳过行内代码
+		parts := strings.Split(line, "`")
+		for j := 0; j < len(parts); j += 2 {
+			parts[j] = replacer.Replace(parts[j])
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,75 @@
+package feishu
+
+import (
+	"testing"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+func mentionEvent(key, openID, name string) *larkim.MentionEvent {
+	m := &larkim.MentionEvent{Key: larkcore.StringPtr(key), Id: &larkim.UserId{OpenId: larkcore.StringPtr(openID)}}
+	if name != "" {
+		m.Name = larkcore.StringPtr(name)
+	}
+	return m
+}
+
+func TestResolveMentions(t *testing.T) {
+	c := &Client{botOpenID: "ou_bot"}
+	bot := mentionEvent("@_user_1", "ou_bot", "机器人")
+	alice := mentionEvent("@_user_2", "ou_a", "Alice")
+	unnamed := mentionEvent("@_user_3", "ou_c", "")
+
+	tests := []struct {
+		name     string
+		text     string
+		mentions []*larkim.MentionEvent
+		want     string
+	}{
+		{"bot removed", "@_user_1 帮我看看", []*larkim.MentionEvent{bot}, "帮我看看"},
+		{"bot in middle", "请 @_user_1  看看", []*larkim.MentionEvent{bot}, "请 看看"},
+		{"user named", "@_user_1 问下 @_user_2 的意见", []*larkim.MentionEvent{bot, alice}, "问下 @Alice 的意见"},
+		{"unnamed keeps key", "@_user_3 你好", []*larkim.MentionEvent{unnamed}, "@_user_3 你好"},
+		// 占位符按整词匹配, @_user_1 不会替换 @_user_10 的前缀
+		{"whole word", "@_user_10 和 @_user_1", []*larkim.MentionEvent{bot, mentionEvent("@_user_10", "ou_x", "X")}, "@X 和"},
+		{"nil key skipped", "@_user_1 hi", []*larkim.MentionEvent{{}}, "@_user_1 hi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.resolveMentions(tt.text, tt.mentions); got != tt.want {
+				t.Errorf("resolveMentions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 未获取到机器人信息时任何提及都视为提及机器人
+	if got := (&Client{}).resolveMentions("@_user_2 hi", []*larkim.MentionEvent{alice}); got != "hi" {
+		t.Errorf("without bot info: resolveMentions() = %q, want %q", got, "hi")
+	}
+}
+
+func TestLinkMentions(t *testing.T) {
+	users := []Mention{{Name: "Al", OpenID: "ou_al"}, {Name: "Alice", OpenID: "ou_alice"}, {Name: "", OpenID: "ou_x"}}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "谢谢 @Alice", `谢谢 <at user_id="ou_alice">Alice</at>`},
+		{"longest name first", "@Al 和 @Alice", `<at user_id="ou_al">Al</at> 和 <at user_id="ou_alice">Alice</at>`},
+		{"unknown user", "@Bob 你好", "@Bob 你好"},
+		{"inline code", "用 `@Alice` 提及 @Alice", "用 `@Alice` 提及 <at user_id=\"ou_alice\">Alice</at>"},
+		{"code block", "```\n@Alice\n```\n@Al", "```\n@Alice\n```\n<at user_id=\"ou_al\">Al</at>"},
+		// 回复中自带的提及标签不生效, 避免提示词注入 @所有人
+		{"injected tag", `<at user_id="all">所有人</at> <AT id=all></AT>`, "<\u200bat user_id=\"all\">所有人<\u200b/at> <\u200bat id=all><\u200b/at>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := linkMentions(tt.text, users); got != tt.want {
+				t.Errorf("linkMentions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package feishu
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 群聊响应策略
+const (
+	GroupPolicyMention  = "mention"  // 只响应 @机器人 的消息
+	GroupPolicyAlways   = "always"   // 响应所有消息
+	GroupPolicyKeywords = "keywords" // 响应 @机器人 或命中关键词、正则的消息
+	GroupPolicyOff      = "off"      // 不响应群聊消息
+)
+
+// GroupPolicy 群聊响应策略
+type GroupPolicy struct {
+	Mode string
+	// Keywords 按整词匹配 (忽略大小写), Patterns 为正则规则, 仅 keywords 模式使用
+	Keywords []string
+	Patterns []*regexp.Regexp
+}
+
+// groupPolicyFor 返回会话使用的群聊响应策略
+func (c *Client) groupPolicyFor(chatID string) GroupPolicy {
+	if policy, ok := c.opts.ChatGroupPolicies[chatID]; ok {
+		return policy
+	}
+	return c.opts.GroupPolicy
+}
+
+// shouldRespondInGroup 判断是否响应群聊消息, mentioned 表示消息 @ 了机器人
+func (c *Client) shouldRespondInGroup(chatID, text string, mentioned bool) bool {
+	policy := c.groupPolicyFor(chatID)
+	switch policy.Mode {
+	case GroupPolicyOff:
+		return false
+	case GroupPolicyAlways:
+		return true
+	case GroupPolicyMention:
+		return mentioned
+	default:
+		return mentioned || policy.match(text)
+	}
+}
+
+// match 判断文本是否命中关键词或正则规则
+func (p GroupPolicy) match(text string) bool {
+	text = strings.TrimSpace(text)
+	for _, keyword := range p.Keywords {
+		if containsWord(text, keyword) {
+			return true
+		}
+	}
+	for _, re := range p.Patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWord 忽略大小写查找关键词, 关键词边缘为字母或数字时要求该侧是词边界
+// 因此 "how" 不会匹配 "show", 而中文关键词仍按子串匹配
+func containsWord(text, word string) bool {
+	if word == "" {
+		return false
+	}
+	text, word = strings.ToLower(text), strings.ToLower(word)
+	first, _ := utf8.DecodeRuneInString(word)
+	last, _ := utf8.DecodeLastRuneInString(word)
+
+	for offset := 0; offset < len(text); {
+		i := strings.Index(text[offset:], word)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (!isWordRune(first) || start == 0 || !isWordRune(before)) &&
+			(!isWordRune(last) || end == len(text) || !isWordRune(after)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		offset = start + size
+	}
+	return false
+}
+
+// isWordRune 判断是否为构成英文单词的字符, 中文等字符之间不存在词边界
+func isWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
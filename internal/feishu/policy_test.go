@@ -0,0 +1,33 @@
+package feishu
+
+import "testing"
+
+func TestContainsWord(t *testing.T) {
+	tests := []struct {
+		text, word string
+		want       bool
+	}{
+		{"how are you", "how", true},
+		{"please show me", "how", false},
+		{"HOW to deploy", "how", true},
+		{"deploy, how?", "how", true},
+		{"show me how", "how", true},
+		{"showhow", "how", false},
+		{"how_to", "how", false},
+		{"v2 released", "v2", true},
+		{"v22 released", "v2", false},
+		{"请帮我部署服务", "部署", true},
+		{"deploy部署", "部署", true},
+		{"部署deploy", "deploy", true},
+		{"c++ question", "c++", true},
+		{"abc++ question", "c++", false},
+		{"@bot help", "@bot", true},
+		{"ping", "", false},
+		{"", "how", false},
+	}
+	for _, tt := range tests {
+		if got := containsWord(tt.text, tt.word); got != tt.want {
+			t.Errorf("containsWord(%q, %q) = %v, want %v", tt.text, tt.word, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package feishu
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PostContent 富文本 (post) 消息内容
+type PostContent struct {
+	Title   string          `json:"title"`
+	Content [][]PostElement `json:"content"`
+}
+
+// PostElement 富文本中的一个节点
+type PostElement struct {
+	Tag       string   `json:"tag"`
+	Text      string   `json:"text,omitempty"`
+	Href      string   `json:"href,omitempty"`
+	UserID    string   `json:"user_id,omitempty"`
+	UserName  string   `json:"user_name,omitempty"`
+	ImageKey  string   `json:"image_key,omitempty"`
+	FileKey   string   `json:"file_key,omitempty"`
+	Language  string   `json:"language,omitempty"`
+	EmojiType string   `json:"emoji_type,omitempty"`
+	Style     []string `json:"style,omitempty"`
+}
+
+// parsePost 解析富文本消息内容
+// 接收事件中的内容直接为 {title, content}, 也兼容按语言包裹的 {"zh_cn": {...}} 格式
+func parsePost(raw string) (*PostContent, error) {
+	var post PostContent
+	if err := json.Unmarshal([]byte(raw), &post); err != nil {
+		return nil, err
+	}
+	if post.Content != nil {
+		return &post, nil
+	}
+
+	var localized map[string]PostContent
+	if err := json.Unmarshal([]byte(raw), &localized); err != nil {
+		return nil, err
+	}
+	for _, locale := range []string{"zh_cn", "en_us", "ja_jp"} {
+		if p, ok := localized[locale]; ok {
+			return &p, nil
+		}
+	}
+	for _, p := range localized {
+		return &p, nil
+	}
+	return nil, fmt.Errorf("富文本内容为空")
+}
+
+// flattenPost 将富文本展开为类 markdown 文本
+// 保留链接、代码块和样式; @ 提及保留为 @_user_N 占位符, 与文本消息的处理方式一致
+func flattenPost(post *PostContent) string {
+	var lines []string
+	if title := strings.TrimSpace(post.Title); title != "" {
+		lines = append(lines, "# "+title)
+	}
+
+	for _, paragraph := range post.Content {
+		var sb strings.Builder
+		for _, elem := range paragraph {
+			switch elem.Tag {
+			case "text":
+				sb.WriteString(applyPostStyle(elem.Text, elem.Style))
+			case "md":
+				sb.WriteString(elem.Text)
+			case "a":
+				text := elem.Text
+				if text == "" {
+					text = elem.Href
+				}
+				fmt.Fprintf(&sb, "[%s](%s)", text, elem.Href)
+			case "at":
+				switch {
+				case elem.UserID == "all":
+					sb.WriteString("@所有人")
+				case strings.HasPrefix(elem.UserID, "@_user_"):
+					sb.WriteString(elem.UserID)
+				case elem.UserName != "":
+					sb.WriteString("@" + elem.UserName)
+				}
+			case "code_block":
+				if sb.Len() > 0 {
+					lines = append(lines, sb.String())
+					sb.Reset()
+				}
+				code := strings.TrimRight(elem.Text, "\n")
+				lines = append(lines, "```"+strings.ToLower(elem.Language)+"\n"+code+"\n```")
+			case "hr":
+				sb.WriteString("---")
+			case "img":
+				sb.WriteString("[图片]")
+			case "media":
+				sb.WriteString("[视频]")
+			case "emotion":
+				sb.WriteString(":" + elem.EmojiType + ":")
+			default:
+				sb.WriteString(elem.Text)
+			}
+		}
+		if sb.Len() > 0 {
+			lines = append(lines, sb.String())
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// postImages 收集富文本中的图片
+func postImages(post *PostContent) []resourceRef {
+	var refs []resourceRef
+	for _, paragraph := range post.Content {
+		for _, elem := range paragraph {
+			if elem.Tag == "img" && elem.ImageKey != "" {
+				refs = append(refs, resourceRef{Key: elem.ImageKey, Type: "image"})
+			}
+		}
+	}
+	return refs
+}
+
+// applyPostStyle 将富文本样式转换为 markdown 标记
+func applyPostStyle(text string, styles []string) string {
+	if strings.TrimSpace(text) == "" {
+		return text
+	}
+	for _, style := range styles {
+		switch style {
+		case "bold":
+			text = "**" + text + "**"
+		case "italic":
+			text = "*" + text + "*"
+		case "lineThrough":
+			text = "~~" + text + "~~"
+		}
+	}
+	return text
+}
@@ -0,0 +1,67 @@
+package feishu
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlattenPost(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{
+			name: "title and styles",
+			raw: `{"title":"周报","content":[[{"tag":"text","text":"完成 "},{"tag":"text","text":"部署","style":["bold"]},
+				{"tag":"text","text":" ","style":["bold"]},{"tag":"text","text":"旧方案","style":["lineThrough","italic"]}]]}`,
+			want: "# 周报\n完成 **部署** *~~旧方案~~*",
+		},
+		{
+			name: "links and mentions",
+			raw: `{"title":"","content":[[{"tag":"at","user_id":"@_user_1","user_name":"机器人"},{"tag":"text","text":" 看 "},
+				{"tag":"a","text":"文档","href":"https://x/doc"},{"tag":"text","text":" "},{"tag":"a","href":"https://x/raw"}],
+				[{"tag":"at","user_id":"all"},{"tag":"at","user_id":"ou_x","user_name":"张三"}]]}`,
+			want: "@_user_1 看 [文档](https://x/doc) [https://x/raw](https://x/raw)\n@所有人@张三",
+		},
+		{
+			name: "code block splits paragraph",
+			raw: `{"content":[[{"tag":"text","text":"报错:"},{"tag":"code_block","language":"GO","text":"panic(err)\n"},
+				{"tag":"text","text":"怎么办"}]]}`,
+			want: "报错:\n```go\npanic(err)\n```\n怎么办",
+		},
+		{
+			name: "media and emotion",
+			raw: `{"content":[[{"tag":"img","image_key":"img_1"}],[{"tag":"media","file_key":"f"},{"tag":"emotion","emoji_type":"SMILE"}],
+				[{"tag":"hr"}],[{"tag":"md","text":"**原样**"}],[]]}`,
+			want: "[图片]\n[视频]:SMILE:\n---\n**原样**",
+		},
+		{
+			name: "localized",
+			raw:  `{"en_us":{"title":"en","content":[[{"tag":"text","text":"hi"}]]},"zh_cn":{"title":"中文","content":[[{"tag":"text","text":"你好"}]]}}`,
+			want: "# 中文\n你好",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post, err := parsePost(tt.raw)
+			if err != nil {
+				t.Fatalf("parsePost: %v", err)
+			}
+			if got := flattenPost(post); got != tt.want {
+				t.Errorf("flattenPost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostImages(t *testing.T) {
+	post, err := parsePost(`{"content":[[{"tag":"img","image_key":"img_1"},{"tag":"text","text":"a"}],[{"tag":"img"},{"tag":"img","image_key":"img_2"}]]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []resourceRef{{Key: "img_1", Type: "image"}, {Key: "img_2", Type: "image"}}
+	if got := postImages(post); !reflect.DeepEqual(got, want) {
+		t.Errorf("postImages() = %+v, want %+v", got, want)
+	}
+}
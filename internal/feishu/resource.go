@@ -0,0 +1,182 @@
+package feishu
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// 图片大小上限, 与飞书图片消息的上限一致
+const maxImageBytes = 10 << 20
+
+// 未配置时的文件大小上限
+const defaultMaxFileBytes = 10 << 20
+
+// textFileExts 按扩展名识别可直接提取文本的文件
+var textFileExts = map[string]bool{
+	"txt": true, "log": true, "md": true, "markdown": true, "csv": true, "tsv": true,
+	"json": true, "jsonl": true, "yaml": true, "yml": true, "toml": true, "ini": true,
+	"conf": true, "cfg": true, "env": true, "xml": true, "html": true, "htm": true, "css": true,
+	"sql": true, "sh": true, "bash": true, "zsh": true, "ps1": true, "bat": true,
+	"go": true, "mod": true, "sum": true, "py": true, "js": true, "mjs": true, "ts": true, "tsx": true,
+	"jsx": true, "java": true, "kt": true, "scala": true, "c": true, "h": true, "cc": true,
+	"cpp": true, "hpp": true, "cs": true, "rs": true, "rb": true, "php": true, "swift": true,
+	"lua": true, "r": true, "pl": true, "vue": true, "proto": true, "gradle": true, "diff": true, "patch": true,
+}
+
+// Attachment 消息附带的资源 (图片、文件)
+type Attachment struct {
+	Type     string // image 或 file
+	FileName string
+	MimeType string
+	Data     []byte
+	// Text 为可提取文本的文件内容, 为空表示二进制文件
+	Text string
+}
+
+// resourceRef 消息中引用的资源, 在处理消息时再下载
+type resourceRef struct {
+	Key  string
+	Type string
+	Name string
+}
+
+type ImageContent struct {
+	ImageKey string `json:"image_key"`
+}
+
+type FileContent struct {
+	FileKey  string `json:"file_key"`
+	FileName string `json:"file_name"`
+}
+
+// checkFileType 检查文件扩展名是否在允许列表中, 列表为空表示不限制
+func (c *Client) checkFileType(name string) error {
+	if len(c.opts.AllowedFileTypes) == 0 {
+		return nil
+	}
+	ext := fileExt(name)
+	for _, allowed := range c.opts.AllowedFileTypes {
+		if ext == allowed {
+			return nil
+		}
+	}
+	if ext == "" {
+		return fmt.Errorf("不支持无扩展名的文件")
+	}
+	return fmt.Errorf("不支持的文件类型: .%s", ext)
+}
+
+func (c *Client) maxBytes(resourceType string) int64 {
+	if resourceType == "image" {
+		return maxImageBytes
+	}
+	if c.opts.MaxFileBytes > 0 {
+		return c.opts.MaxFileBytes
+	}
+	return defaultMaxFileBytes
+}
+
+// downloadResource 通过消息资源接口下载消息中的图片或文件
+func (c *Client) downloadResource(ctx context.Context, msgID string, ref resourceRef) (*Attachment, error) {
+	if ref.Type == "file" {
+		if err := c.checkFileType(ref.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	req := larkim.NewGetMessageResourceReqBuilder().
+		MessageId(msgID).
+		FileKey(ref.Key).
+		Type(ref.Type).
+		Build()
+
+	resp, err := c.larkCli.Im.V1.MessageResource.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success() {
+		return nil, fmt.Errorf("下载资源失败: %s", resp.Msg)
+	}
+
+	limit := c.maxBytes(ref.Type)
+	data, err := io.ReadAll(io.LimitReader(resp.File, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取资源失败: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("超过大小上限 %s", formatBytes(limit))
+	}
+
+	name := ref.Name
+	if name == "" {
+		name = resp.FileName
+	}
+	att := &Attachment{
+		Type:     ref.Type,
+		FileName: name,
+		MimeType: http.DetectContentType(data),
+		Data:     data,
+	}
+	if ref.Type == "file" {
+		att.Text = extractText(name, att.MimeType, data)
+	}
+	return att, nil
+}
+
+// downloadAttachments 下载消息引用的所有资源
+// 单个资源失败时跳过并返回失败原因, 供提示用户
+func (c *Client) downloadAttachments(ctx context.Context, msgID string, refs []resourceRef) ([]Attachment, []string) {
+	var attachments []Attachment
+	var failures []string
+	for _, ref := range refs {
+		att, err := c.downloadResource(ctx, msgID, ref)
+		if err != nil {
+			slog.Warn("下载消息资源失败", "message_id", msgID, "type", ref.Type, "key", ref.Key, "error", err)
+			failures = append(failures, fmt.Sprintf("%s: %v", describeRef(ref), err))
+			continue
+		}
+		attachments = append(attachments, *att)
+	}
+	return attachments, failures
+}
+
+// extractText 提取文本类文件的内容, 无法识别为 UTF-8 文本时返回空字符串
+func extractText(name, mimeType string, data []byte) string {
+	isText := textFileExts[fileExt(name)] ||
+		strings.HasPrefix(mimeType, "text/") ||
+		strings.HasPrefix(mimeType, "application/json")
+	if !isText || !utf8.Valid(data) {
+		return ""
+	}
+	return strings.TrimPrefix(string(data), "\ufeff")
+}
+
+// describeRef 返回资源的简短描述, 用于提示文本
+func describeRef(ref resourceRef) string {
+	if ref.Type == "image" {
+		return "[图片]"
+	}
+	if ref.Name != "" {
+		return "[文件] " + ref.Name
+	}
+	return "[文件]"
+}
+
+func fileExt(name string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+}
+
+func formatBytes(n int64) string {
+	if n >= 1<<20 {
+		return fmt.Sprintf("%d MB", n>>20)
+	}
+	return fmt.Sprintf("%d KB", n>>10)
+}
@@ -0,0 +1,42 @@
+package feishu
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	"github.com/larksuite/oapi-sdk-go/v3/core/httpserverext"
+	larkevent "github.com/larksuite/oapi-sdk-go/v3/event"
+)
+
+// EventHandler 返回 Webhook 模式下接收飞书事件回调的 HTTP 处理器
+// 请求地址校验 (challenge)、来源校验、签名校验和解密由 SDK 分发器完成
+// Start 之前和退出之后返回 503, 飞书会稍后重新推送, 避免事件在处理器就绪前被丢弃
+func (c *Client) EventHandler() http.Handler {
+	handle := httpserverext.NewEventHandlerFunc(c.events,
+		larkevent.WithLogger(sdkLogger{redact: c.opts.RedactLogs}),
+		larkevent.WithLogLevel(larkcore.LogLevelDebug),
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !c.monitor.state().Connected {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		handle(w, r)
+	})
+}
+
+// serveWebhook 以 Webhook 模式运行: 事件由 EventHandler 接收, 这里只维护就绪状态直到 context 取消
+func (c *Client) serveWebhook(ctx context.Context) error {
+	slog.Info("飞书事件回调已就绪, 等待飞书推送事件")
+	c.monitor.setConnected(true)
+	defer c.monitor.setConnected(false)
+
+	<-ctx.Done()
+	return ctx.Err()
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"unicode/utf8"
+)
+
+// 日志格式
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// contentKeys 为消息正文类字段, 开启脱敏时只记录长度
+var contentKeys = map[string]bool{
+	"text":    true,
+	"content": true,
+	"reply":   true,
+}
+
+// secretKeys 为密钥类字段, 开启脱敏时只保留前 4 个字符
+var secretKeys = map[string]bool{
+	"token":      true,
+	"secret":     true,
+	"app_secret": true,
+	"auth":       true,
+}
+
+// secretPattern 匹配自由文本 (如 SDK 日志) 中的令牌
+var secretPattern = regexp.MustCompile(`(?i)(bearer\s+|(?:access_token|token|secret)["']?\s*[:=]\s*["']?)([A-Za-z0-9._\-]{8,})`)
+
+// Options 日志配置
+type Options struct {
+	Level  string // debug、info、warn 或 error
+	Format string // text 或 json
+	// Redact 为 true 时隐藏消息正文和令牌, 关闭后用于排查问题
+	Redact bool
+}
+
+// Setup 按配置创建日志处理器并设为默认, 标准库 log 包的输出同样经由该处理器
+func Setup(w io.Writer, opts Options) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return fmt.Errorf("日志级别 %q 无效，可选值: debug、info、warn、error", opts.Level)
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	if opts.Redact {
+		handlerOpts.ReplaceAttr = redactAttr
+	}
+
+	var handler slog.Handler
+	switch opts.Format {
+	case FormatText:
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return fmt.Errorf("日志格式 %q 无效，可选值: text、json", opts.Format)
+	}
+	if opts.Redact {
+		handler = &redactHandler{Handler: handler}
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// redactAttr 隐藏正文和密钥类字段
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch {
+	case contentKeys[a.Key]:
+		return slog.String(a.Key, fmt.Sprintf("[%d chars]", utf8.RuneCountInString(a.Value.String())))
+	case secretKeys[a.Key]:
+		return slog.String(a.Key, MaskSecret(a.Value.String()))
+	}
+	return a
+}
+
+// redactHandler 隐藏日志消息文本中的令牌
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	if msg := RedactSecrets(r.Message); msg != r.Message {
+		redacted := slog.NewRecord(r.Time, r.Level, msg, r.PC)
+		r.Attrs(func(a slog.Attr) bool {
+			redacted.AddAttrs(a)
+			return true
+		})
+		r = redacted
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &redactHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// RedactSecrets 将文本中形如 "Bearer xxx"、"token=xxx" 的令牌替换为打码后的值
+func RedactSecrets(s string) string {
+	return secretPattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := secretPattern.FindStringSubmatch(m)
+		return parts[1] + MaskSecret(parts[2])
+	})
+}
+
+// MaskSecret 只保留前 4 个字符
+func MaskSecret(s string) string {
+	if len(s) <= 4 {
+		return "****"
+	}
+	return s[:4] + "****"
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "moltbot_feishu"
+
+// agent 运行结果
+const (
+	RunCompleted = "completed"
+	RunError     = "error"
+	RunTimeout   = "timeout"
+	RunStopped   = "stopped"
+	RunCanceled  = "canceled"
+)
+
+// 运行耗时分桶: 0.25 秒到约 4 分钟
+var durationBuckets = prometheus.ExponentialBuckets(0.25, 2, 11)
+
+var (
+	// MessagesReceived 收到的消息 (去重后), 按会话类型和消息类型统计
+	MessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_received_total",
+		Help:      "Messages received from Feishu after deduplication, by chat type and message type.",
+	}, []string{"chat_type", "msg_type"})
+
+	// MessagesFiltered 被群聊响应策略过滤的消息
+	MessagesFiltered = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_filtered_total",
+		Help:      "Group messages ignored by the group response policy.",
+	})
+
+	// DuplicatesDropped 重复投递而被丢弃的消息
+	DuplicatesDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicates_dropped_total",
+		Help:      "Redelivered Feishu messages dropped by deduplication.",
+	})
+
+	// AgentRunsStarted 发起的 agent 运行
+	AgentRunsStarted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "agent_runs_started_total",
+		Help:      "Agent runs started.",
+	})
+
+	// AgentRunsFinished 结束的 agent 运行, 按结果统计
+	AgentRunsFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "agent_runs_finished_total",
+		Help:      "Agent runs finished, by result (completed, error, timeout, stopped, canceled).",
+	}, []string{"result"})
+
+	// FirstDeltaSeconds 从发起运行到收到第一个回复片段的时间
+	FirstDeltaSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "agent_first_delta_seconds",
+		Help:      "Time from starting an agent run to its first reply delta.",
+		Buckets:   durationBuckets,
+	})
+
+	// RunDurationSeconds agent 运行的总耗时
+	RunDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "agent_run_duration_seconds",
+		Help:      "Total duration of agent runs.",
+		Buckets:   durationBuckets,
+	})
+
+	// FeishuSendFailures 调用飞书消息接口失败, 按接口统计
+	FeishuSendFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feishu_send_failures_total",
+		Help:      "Failed Feishu message API calls, by API (create, reply, update, patch).",
+	}, []string{"api"})
+
+	// GatewayReconnects 与 Gateway 重连成功的次数
+	GatewayReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gateway_reconnects_total",
+		Help:      "Successful reconnects to the Moltbot gateway.",
+	})
+)
+
+// Handler 返回 /metrics 接口的处理器
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -3,14 +3,17 @@ package moltbot
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+
+	"github.com/vogo/moltbot-feishu/internal/metrics"
 )
 
 const (
@@ -18,19 +21,193 @@ const (
 	ClientVersion   = "0.2.0"
 )
 
+const (
+	// 单个请求等待响应的超时时间
+	requestTimeout = 30 * time.Second
+	// 等待 connect.challenge 的超时时间
+	challengeTimeout = 5 * time.Second
+	// 重连时单次拨号 + 握手的超时时间
+	dialTimeout = 10 * time.Second
+
+	// 重连退避: 从 minBackoff 开始翻倍, 最多 maxBackoff
+	minBackoff = 1 * time.Second
+	maxBackoff = 30 * time.Second
+
+	// 心跳: 每 pingInterval 发送一次 ping, pongWait 内无任何数据视为断线
+	pingInterval = 30 * time.Second
+	pongWait     = 75 * time.Second
+)
+
+var (
+	// ErrDisconnected 请求或运行过程中与 Gateway 的连接断开
+	ErrDisconnected = errors.New("与 Gateway 的连接已断开")
+	// ErrClosed 客户端已关闭
+	ErrClosed = errors.New("客户端已关闭")
+)
+
 type Client struct {
 	gatewayURL   string
 	gatewayToken string
 	agentID      string
 
-	conn     *websocket.Conn
-	connLock sync.Mutex
+	// 客户端生命周期, Close 时取消, 用于停止重连
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// conn 为当前可用连接, 断线重连期间为 nil
+	// ready 在连接就绪时关闭, 断线时替换为新的通道
+	// lastEvent 为最近一次收到 Gateway 事件的时间
+	conn       *gatewayConn
+	ready      chan struct{}
+	reconnects int
+	lastEvent  time.Time
+	connLock   sync.Mutex
 
-	pendingReqs map[string]chan *Response
+	pendingReqs map[string]*pendingRequest
 	reqLock     sync.Mutex
 
 	eventHandlers map[string]func(payload json.RawMessage)
 	handlerLock   sync.RWMutex
+
+	// 进行中的 agent 运行, 按 runId 分发事件
+	runs    map[string]*agentRun
+	runLock sync.Mutex
+}
+
+// logger 返回带组件字段的日志记录器, 每次从默认记录器派生, 以使用启动后设置的日志配置
+func logger() *slog.Logger {
+	return slog.Default().With("component", "moltbot")
+}
+
+// pendingRequest 等待响应的请求
+type pendingRequest struct {
+	respCh chan *Response
+	// onResponse 在读循环中同步执行, 保证先于该请求之后到达的事件
+	onResponse func(resp *Response)
+}
+
+// agentRun 一次 agent 运行的订阅
+// 读循环只把增量和结束状态放入队列, 由每个运行自己的 goroutine 转发给调用方,
+// 调用方读取缓慢时不会阻塞读循环, 也就不会影响其他会话和请求响应
+type agentRun struct {
+	deltaCh chan string
+	errCh   chan error
+	// done 在转发结束 (完成、失败或取消) 时关闭
+	done chan struct{}
+
+	queue    []string
+	finished bool
+	err      error
+	mu       sync.Mutex
+	// notify 在队列或结束状态变化时通知转发 goroutine
+	notify chan struct{}
+	// abort 在调用方放弃时关闭, 丢弃未转发的增量
+	abort     chan struct{}
+	abortOnce sync.Once
+}
+
+func newAgentRun() *agentRun {
+	run := &agentRun{
+		deltaCh: make(chan string),
+		errCh:   make(chan error, 1),
+		done:    make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+		abort:   make(chan struct{}),
+	}
+	go run.forward()
+	return run
+}
+
+// push 追加增量, 运行已结束时忽略
+func (r *agentRun) push(delta string) {
+	r.mu.Lock()
+	if !r.finished {
+		r.queue = append(r.queue, delta)
+	}
+	r.mu.Unlock()
+	r.wake()
+}
+
+// finish 标记运行结束, 已排队的增量转发完后关闭增量通道 (err 为 nil) 或写入错误通道
+func (r *agentRun) finish(err error) {
+	r.mu.Lock()
+	if !r.finished {
+		r.finished, r.err = true, err
+	}
+	r.mu.Unlock()
+	r.wake()
+}
+
+// cancel 调用方放弃运行, 不再转发剩余增量
+func (r *agentRun) cancel(err error) {
+	r.finish(err)
+	r.abortOnce.Do(func() { close(r.abort) })
+}
+
+func (r *agentRun) wake() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// forward 按顺序把增量转发到增量通道, 运行结束后通知调用方
+func (r *agentRun) forward() {
+	defer close(r.done)
+	for {
+		r.mu.Lock()
+		if len(r.queue) > 0 {
+			delta := r.queue[0]
+			r.queue = r.queue[1:]
+			r.mu.Unlock()
+			select {
+			case r.deltaCh <- delta:
+				continue
+			case <-r.abort:
+				r.errCh <- r.finalErr()
+				return
+			}
+		}
+		if r.finished {
+			err := r.err
+			r.mu.Unlock()
+			if err != nil {
+				r.errCh <- err
+			} else {
+				close(r.deltaCh)
+			}
+			return
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-r.notify:
+		case <-r.abort:
+		}
+	}
+}
+
+func (r *agentRun) finalErr() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// gatewayConn 一条已建立的 WebSocket 连接
+type gatewayConn struct {
+	ws        *websocket.Conn
+	writeLock sync.Mutex
+
+	// challenge 收到 connect.challenge 时写入
+	challenge chan struct{}
+	// done 在读循环退出 (连接断开) 时关闭
+	done chan struct{}
+}
+
+func (gc *gatewayConn) writeJSON(v interface{}) error {
+	gc.writeLock.Lock()
+	defer gc.writeLock.Unlock()
+	return gc.ws.WriteJSON(v)
 }
 
 type Request struct {
@@ -77,11 +254,22 @@ type AuthInfo struct {
 }
 
 type AgentParams struct {
-	Message        string `json:"message"`
-	AgentID        string `json:"agentId"`
-	SessionKey     string `json:"sessionKey"`
-	Deliver        bool   `json:"deliver"`
-	IdempotencyKey string `json:"idempotencyKey"`
+	Message        string       `json:"message"`
+	AgentID        string       `json:"agentId"`
+	SessionKey     string       `json:"sessionKey"`
+	Deliver        bool         `json:"deliver"`
+	IdempotencyKey string       `json:"idempotencyKey"`
+	Attachments    []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment 随消息发送给 agent 的附件
+// 二进制内容以 base64 编码放在 Content 中, 文本文件的内容直接放在 Text 中
+type Attachment struct {
+	Type     string `json:"type"`
+	MimeType string `json:"mimeType"`
+	FileName string `json:"fileName,omitempty"`
+	Content  string `json:"content,omitempty"`
+	Text     string `json:"text,omitempty"`
 }
 
 type AgentResponse struct {
@@ -100,63 +288,105 @@ type AssistantDelta struct {
 
 type LifecycleData struct {
 	Phase string `json:"phase"`
+	Error string `json:"error,omitempty"`
 }
 
 func NewClient(port int, token, agentID string) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
 		gatewayURL:    fmt.Sprintf("ws://127.0.0.1:%d", port),
 		gatewayToken:  token,
 		agentID:       agentID,
-		pendingReqs:   make(map[string]chan *Response),
+		ctx:           ctx,
+		cancel:        cancel,
+		ready:         make(chan struct{}),
+		pendingReqs:   make(map[string]*pendingRequest),
 		eventHandlers: make(map[string]func(payload json.RawMessage)),
+		runs:          make(map[string]*agentRun),
 	}
 }
 
+// Connect 建立到 Gateway 的首个连接
+// 连接成功后, 断线会自动以指数退避重连并重新握手, 直到 Close 被调用
 func (c *Client) Connect(ctx context.Context) error {
-	log.Printf("[Moltbot] 开始连接 Gateway: %s", c.gatewayURL)
+	logger().Info("开始连接 Gateway", "url", c.gatewayURL)
+
+	gc, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.setConn(gc)
+	logger().Info("认证成功, 连接就绪")
+
+	go c.supervise(gc)
+	return nil
+}
 
+// Connected 返回当前是否与 Gateway 保持已认证的连接
+func (c *Client) Connected() bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.conn != nil
+}
+
+// Reconnects 返回自启动以来成功重连的次数
+func (c *Client) Reconnects() int {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.reconnects
+}
+
+// LastEventAt 返回最近一次收到 Gateway 事件的时间, 尚未收到时为零值
+func (c *Client) LastEventAt() time.Time {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.lastEvent
+}
+
+// dial 建立 WebSocket 连接并完成 connect.challenge / connect 握手
+func (c *Client) dial(ctx context.Context) (*gatewayConn, error) {
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 10 * time.Second,
 	}
 
-	log.Printf("[Moltbot] 正在建立 WebSocket 连接...")
-	conn, _, err := dialer.DialContext(ctx, c.gatewayURL, nil)
+	logger().Debug("正在建立 WebSocket 连接")
+	ws, _, err := dialer.DialContext(ctx, c.gatewayURL, nil)
 	if err != nil {
-		log.Printf("[Moltbot] WebSocket 连接失败: %v", err)
-		return fmt.Errorf("连接 Gateway 失败: %w", err)
+		logger().Warn("WebSocket 连接失败", "error", err)
+		return nil, fmt.Errorf("连接 Gateway 失败: %w", err)
 	}
+	logger().Debug("WebSocket 连接已建立")
 
-	// 只在设置 conn 时加锁
-	c.connLock.Lock()
-	c.conn = conn
-	c.connLock.Unlock()
-	log.Printf("[Moltbot] WebSocket 连接已建立")
+	gc := &gatewayConn{
+		ws:        ws,
+		challenge: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
 
-	// 启动消息读取协程
-	go c.readLoop()
+	// 启动消息读取协程和心跳
+	go c.readLoop(gc)
+	go c.keepalive(gc)
 
 	// 等待 connect.challenge
-	log.Printf("[Moltbot] 等待 Gateway 握手 (connect.challenge)...")
-	challengeCh := make(chan struct{}, 1)
-	c.OnEvent("connect.challenge", func(_ json.RawMessage) {
-		challengeCh <- struct{}{}
-	})
-
+	logger().Debug("等待 Gateway 握手 (connect.challenge)")
 	select {
-	case <-challengeCh:
-		log.Printf("[Moltbot] 收到握手请求")
-	case <-time.After(5 * time.Second):
-		log.Printf("[Moltbot] 握手超时 (5秒)")
-		conn.Close()
-		return fmt.Errorf("等待 Gateway 握手超时")
+	case <-gc.challenge:
+		logger().Debug("收到握手请求")
+	case <-time.After(challengeTimeout):
+		logger().Warn("握手超时", "timeout", challengeTimeout)
+		ws.Close()
+		return nil, fmt.Errorf("等待 Gateway 握手超时")
+	case <-gc.done:
+		return nil, fmt.Errorf("等待 Gateway 握手失败: %w", ErrDisconnected)
 	case <-ctx.Done():
-		log.Printf("[Moltbot] 连接被取消")
-		conn.Close()
-		return ctx.Err()
+		logger().Info("连接被取消")
+		ws.Close()
+		return nil, ctx.Err()
 	}
 
 	// 发送认证请求
-	log.Printf("[Moltbot] 发送认证请求 (protocol=%d, role=operator)...", ProtocolVersion)
+	logger().Debug("发送认证请求", "protocol", ProtocolVersion, "role", "operator")
 	platform := runtime.GOOS
 	params := ConnectParams{
 		MinProtocol: ProtocolVersion,
@@ -174,31 +404,126 @@ func (c *Client) Connect(ctx context.Context) error {
 		UserAgent: "moltbot-feishu-bridge-go",
 	}
 
-	resp, err := c.sendRequest(ctx, "connect", "connect", params)
+	resp, err := c.roundTrip(ctx, gc, "connect", params, nil)
 	if err != nil {
-		log.Printf("[Moltbot] 认证请求失败: %v", err)
-		conn.Close()
-		return fmt.Errorf("认证失败: %w", err)
+		logger().Warn("认证请求失败", "error", err)
+		ws.Close()
+		return nil, fmt.Errorf("认证失败: %w", err)
 	}
 	if !resp.OK {
-		conn.Close()
+		ws.Close()
 		errMsg := "未知错误"
 		if resp.Error != nil {
 			errMsg = resp.Error.Message
 		}
-		log.Printf("[Moltbot] 认证被拒绝: %s", errMsg)
-		return fmt.Errorf("认证被拒绝: %s", errMsg)
+		logger().Error("认证被拒绝", "error", errMsg)
+		return nil, fmt.Errorf("认证被拒绝: %s", errMsg)
 	}
 
-	log.Printf("[Moltbot] 认证成功, 连接就绪")
-	return nil
+	return gc, nil
+}
+
+// supervise 等待连接断开, 然后以指数退避重连, 直到客户端关闭
+func (c *Client) supervise(gc *gatewayConn) {
+	for {
+		select {
+		case <-gc.done:
+		case <-c.ctx.Done():
+			return
+		}
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		c.setConn(nil)
+		c.failRuns(ErrDisconnected)
+		logger().Warn("与 Gateway 的连接已断开, 准备重连")
+
+		gc = c.reconnect()
+		if gc == nil {
+			return
+		}
+	}
+}
+
+// reconnect 循环重连直到成功, 客户端关闭时返回 nil
+func (c *Client) reconnect() *gatewayConn {
+	backoff := minBackoff
+	for attempt := 1; ; attempt++ {
+		logger().Info("等待重连", "backoff", backoff, "attempt", attempt)
+		select {
+		case <-time.After(backoff):
+		case <-c.ctx.Done():
+			return nil
+		}
+
+		dialCtx, cancel := context.WithTimeout(c.ctx, dialTimeout)
+		gc, err := c.dial(dialCtx)
+		cancel()
+		if err == nil {
+			c.connLock.Lock()
+			c.reconnects++
+			c.connLock.Unlock()
+			metrics.GatewayReconnects.Inc()
+			c.setConn(gc)
+			logger().Info("重连成功, 连接就绪")
+			return gc
+		}
+		if c.ctx.Err() != nil {
+			return nil
+		}
+		logger().Warn("重连失败", "error", err)
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// setConn 切换当前连接, gc 为 nil 表示进入断线状态
+func (c *Client) setConn(gc *gatewayConn) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	if gc != nil {
+		if c.conn == nil {
+			close(c.ready)
+		}
+	} else if c.conn != nil {
+		c.ready = make(chan struct{})
+	}
+	c.conn = gc
+}
+
+// waitConn 等待可用连接, 断线重连期间的请求会在此等待而不是直接失败
+func (c *Client) waitConn(ctx context.Context) (*gatewayConn, error) {
+	c.connLock.Lock()
+	gc, ready := c.conn, c.ready
+	c.connLock.Unlock()
+	if gc != nil {
+		return gc, nil
+	}
+
+	select {
+	case <-ready:
+		return c.waitConn(ctx)
+	case <-time.After(requestTimeout):
+		return nil, fmt.Errorf("等待 Gateway 重连超时: %w", ErrDisconnected)
+	case <-c.ctx.Done():
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 }
 
 func (c *Client) Close() error {
+	c.cancel()
+
 	c.connLock.Lock()
 	defer c.connLock.Unlock()
 	if c.conn != nil {
-		return c.conn.Close()
+		return c.conn.ws.Close()
 	}
 	return nil
 }
@@ -209,67 +534,263 @@ func (c *Client) OnEvent(event string, handler func(payload json.RawMessage)) {
 	c.eventHandlers[event] = handler
 }
 
-func (c *Client) SendMessage(ctx context.Context, sessionKey, message string) (string, <-chan string, <-chan error, error) {
-	params := AgentParams{
-		Message:        message,
-		AgentID:        c.agentID,
-		SessionKey:     sessionKey,
-		Deliver:        false,
-		IdempotencyKey: uuid.New().String(),
+// SendMessage 发起一次 agent 运行, 返回 runId 以及该运行的增量和错误通道
+// params 中 AgentID 为空时使用客户端默认 Agent, IdempotencyKey 为空时自动生成
+// 增量通道在运行正常结束时关闭; 运行失败或 ctx 取消时错误通道收到错误
+func (c *Client) SendMessage(ctx context.Context, params AgentParams) (string, <-chan string, <-chan error, error) {
+	if params.AgentID == "" {
+		params.AgentID = c.agentID
+	}
+	if params.IdempotencyKey == "" {
+		params.IdempotencyKey = uuid.New().String()
+	}
+
+	// 在读循环中收到响应时立即登记运行, 避免丢失紧随其后的事件
+	// 读循环与本函数并发访问 run, 由 mu 保护; abandoned 后到达的响应不再登记
+	var mu sync.Mutex
+	var run *agentRun
+	var runID string
+	var abandoned bool
+	register := func(resp *Response) {
+		if !resp.OK || ctx.Err() != nil {
+			return
+		}
+		var agentResp AgentResponse
+		if err := json.Unmarshal(resp.Payload, &agentResp); err != nil || agentResp.RunID == "" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !abandoned {
+			runID = agentResp.RunID
+			run = c.registerRun(runID)
+		}
+	}
+
+	// 请求失败时移除已登记的运行, 如 ctx 在读循环登记运行之后、请求返回之前被取消
+	// 此时 Gateway 已开始运行, 通知其中止
+	abandon := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		abandoned = true
+		if run == nil {
+			return
+		}
+		c.removeRun(runID)
+		run.cancel(err)
+		go func(runID string) {
+			abortCtx, cancel := context.WithTimeout(c.ctx, requestTimeout)
+			defer cancel()
+			if err := c.AbortRun(abortCtx, params.SessionKey, runID); err != nil {
+				logger().Warn("中止已放弃的运行失败", "session_key", params.SessionKey, "run_id", runID, "error", err)
+			}
+		}(runID)
 	}
 
-	resp, err := c.sendRequest(ctx, "agent", "agent", params)
+	// 请求发出后连接断开时重试一次, Gateway 通过 IdempotencyKey 去重
+	resp, err := c.sendRequest(ctx, "agent", params, register)
+	if errors.Is(err, ErrDisconnected) {
+		logger().Warn("agent 请求因断线失败, 重试一次", "session_key", params.SessionKey)
+		resp, err = c.sendRequest(ctx, "agent", params, register)
+	}
 	if err != nil {
+		abandon(err)
+		return "", nil, nil, err
+	}
+	if !resp.OK {
+		errMsg := "请求失败"
+		if resp.Error != nil {
+			errMsg = resp.Error.Message
+		}
+		err := fmt.Errorf("agent 请求失败: %s", errMsg)
+		abandon(err)
 		return "", nil, nil, err
 	}
+	mu.Lock()
+	defer mu.Unlock()
+	if run == nil {
+		return "", nil, nil, fmt.Errorf("解析响应失败: 缺少 runId")
+	}
+
+	// 调用方放弃时清理订阅; 运行已结束但仍有增量未转发时同样需要取消, 以便转发 goroutine 退出
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.removeRun(runID)
+			run.cancel(ctx.Err())
+		case <-run.done:
+		}
+	}()
+
+	return runID, run.deltaCh, run.errCh, nil
+}
+
+// ResetSession 重置会话, 之后的消息将开始新的对话上下文
+func (c *Client) ResetSession(ctx context.Context, sessionKey string) error {
+	resp, err := c.sendRequest(ctx, "sessions.reset", map[string]string{"key": sessionKey}, nil)
+	if err != nil {
+		return err
+	}
 	if !resp.OK {
 		errMsg := "请求失败"
 		if resp.Error != nil {
 			errMsg = resp.Error.Message
 		}
-		return "", nil, nil, fmt.Errorf("agent 请求失败: %s", errMsg)
+		return fmt.Errorf("重置会话失败: %s", errMsg)
 	}
+	return nil
+}
 
-	var agentResp AgentResponse
-	if err := json.Unmarshal(resp.Payload, &agentResp); err != nil {
-		return "", nil, nil, fmt.Errorf("解析响应失败: %w", err)
+// AbortRun 请求 Gateway 中止进行中的运行
+func (c *Client) AbortRun(ctx context.Context, sessionKey, runID string) error {
+	params := map[string]string{"sessionKey": sessionKey, "runId": runID}
+	resp, err := c.sendRequest(ctx, "chat.abort", params, nil)
+	if err != nil {
+		return err
 	}
+	if !resp.OK {
+		errMsg := "请求失败"
+		if resp.Error != nil {
+			errMsg = resp.Error.Message
+		}
+		return fmt.Errorf("中止运行失败: %s", errMsg)
+	}
+	return nil
+}
 
-	// 创建流式响应通道
-	deltaCh := make(chan string, 100)
-	errCh := make(chan error, 1)
+// ListAgents 返回 Gateway 上配置的 Agent ID
+func (c *Client) ListAgents(ctx context.Context) ([]string, error) {
+	resp, err := c.sendRequest(ctx, "agents.list", map[string]string{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		errMsg := "请求失败"
+		if resp.Error != nil {
+			errMsg = resp.Error.Message
+		}
+		return nil, fmt.Errorf("查询 Agent 列表失败: %s", errMsg)
+	}
+	var payload struct {
+		Agents []struct {
+			ID string `json:"id"`
+		} `json:"agents"`
+	}
+	if err := json.Unmarshal(resp.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("解析 Agent 列表失败: %w", err)
+	}
+	ids := make([]string, 0, len(payload.Agents))
+	for _, agent := range payload.Agents {
+		ids = append(ids, agent.ID)
+	}
+	return ids, nil
+}
 
-	// 注册事件处理器
-	c.OnEvent("agent", func(payload json.RawMessage) {
-		var evt AgentEvent
-		if err := json.Unmarshal(payload, &evt); err != nil {
-			return
+// AgentID 返回默认 Agent ID
+func (c *Client) AgentID() string {
+	return c.agentID
+}
+
+// ActiveRuns 返回进行中的 agent 运行数
+func (c *Client) ActiveRuns() int {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+	return len(c.runs)
+}
+
+// registerRun 登记运行, 已登记时返回已有订阅
+func (c *Client) registerRun(runID string) *agentRun {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+
+	if run, ok := c.runs[runID]; ok {
+		return run
+	}
+	run := newAgentRun()
+	c.runs[runID] = run
+	return run
+}
+
+// finishRun 结束运行并移除订阅
+// err 为 nil 时转发完剩余增量后关闭增量通道表示正常结束, 否则将 err 写入错误通道
+func (c *Client) finishRun(runID string, err error) {
+	if run := c.removeRun(runID); run != nil {
+		run.finish(err)
+	}
+}
+
+func (c *Client) removeRun(runID string) *agentRun {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+	run := c.runs[runID]
+	delete(c.runs, runID)
+	return run
+}
+
+// failRuns 通知所有进行中的运行失败
+func (c *Client) failRuns(err error) {
+	c.runLock.Lock()
+	runIDs := make([]string, 0, len(c.runs))
+	for runID := range c.runs {
+		runIDs = append(runIDs, runID)
+	}
+	c.runLock.Unlock()
+
+	for _, runID := range runIDs {
+		c.finishRun(runID, err)
+	}
+}
+
+// dispatchAgentEvent 将 agent 事件分发给对应运行, 在读循环中同步调用以保持增量顺序, 不会阻塞
+func (c *Client) dispatchAgentEvent(payload json.RawMessage) {
+	var evt AgentEvent
+	if err := json.Unmarshal(payload, &evt); err != nil {
+		return
+	}
+
+	c.runLock.Lock()
+	run, ok := c.runs[evt.RunID]
+	c.runLock.Unlock()
+	if !ok {
+		return
+	}
+
+	switch evt.Stream {
+	case "assistant":
+		var delta AssistantDelta
+		if err := json.Unmarshal(evt.Data, &delta); err == nil && delta.Delta != "" {
+			run.push(delta.Delta)
 		}
-		if evt.RunID != agentResp.RunID {
+	case "lifecycle":
+		var lc LifecycleData
+		if err := json.Unmarshal(evt.Data, &lc); err != nil {
 			return
 		}
-
-		switch evt.Stream {
-		case "assistant":
-			var delta AssistantDelta
-			if err := json.Unmarshal(evt.Data, &delta); err == nil && delta.Delta != "" {
-				select {
-				case deltaCh <- delta.Delta:
-				default:
-				}
-			}
-		case "lifecycle":
-			var lc LifecycleData
-			if err := json.Unmarshal(evt.Data, &lc); err == nil && lc.Phase == "end" {
-				close(deltaCh)
+		switch lc.Phase {
+		case "end":
+			c.finishRun(evt.RunID, nil)
+		case "error":
+			errMsg := lc.Error
+			if errMsg == "" {
+				errMsg = "未知错误"
 			}
+			c.finishRun(evt.RunID, fmt.Errorf("agent 运行失败: %s", errMsg))
 		}
-	})
+	}
+}
 
-	return agentResp.RunID, deltaCh, errCh, nil
+// sendRequest 在当前连接上发送请求, 断线重连期间会等待连接恢复
+func (c *Client) sendRequest(ctx context.Context, method string, params interface{}, onResponse func(*Response)) (*Response, error) {
+	gc, err := c.waitConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.roundTrip(ctx, gc, method, params, onResponse)
 }
 
-func (c *Client) sendRequest(ctx context.Context, id, method string, params interface{}) (*Response, error) {
+// roundTrip 在指定连接上发送请求并等待响应, 连接断开时返回 ErrDisconnected
+func (c *Client) roundTrip(ctx context.Context, gc *gatewayConn, method string, params interface{}, onResponse func(*Response)) (*Response, error) {
+	id := uuid.New().String()
 	req := Request{
 		Type:   "req",
 		ID:     id,
@@ -277,9 +798,12 @@ func (c *Client) sendRequest(ctx context.Context, id, method string, params inte
 		Params: params,
 	}
 
-	respCh := make(chan *Response, 1)
+	pending := &pendingRequest{
+		respCh:     make(chan *Response, 1),
+		onResponse: onResponse,
+	}
 	c.reqLock.Lock()
-	c.pendingReqs[id] = respCh
+	c.pendingReqs[id] = pending
 	c.reqLock.Unlock()
 
 	defer func() {
@@ -288,29 +812,40 @@ func (c *Client) sendRequest(ctx context.Context, id, method string, params inte
 		c.reqLock.Unlock()
 	}()
 
-	c.connLock.Lock()
-	err := c.conn.WriteJSON(req)
-	c.connLock.Unlock()
-	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %w", err)
+	if err := gc.writeJSON(req); err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", ErrDisconnected)
 	}
 
 	select {
-	case resp := <-respCh:
+	case resp := <-pending.respCh:
 		return resp, nil
-	case <-time.After(30 * time.Second):
+	case <-gc.done:
+		return nil, ErrDisconnected
+	case <-time.After(requestTimeout):
 		return nil, fmt.Errorf("请求超时")
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
-func (c *Client) readLoop() {
+func (c *Client) readLoop(gc *gatewayConn) {
+	defer close(gc.done)
+	defer gc.ws.Close()
+
+	gc.ws.SetReadDeadline(time.Now().Add(pongWait))
+	gc.ws.SetPongHandler(func(string) error {
+		return gc.ws.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
 	for {
-		_, data, err := c.conn.ReadMessage()
+		_, data, err := gc.ws.ReadMessage()
 		if err != nil {
+			if c.ctx.Err() == nil {
+				logger().Warn("读取消息失败", "error", err)
+			}
 			return
 		}
+		gc.ws.SetReadDeadline(time.Now().Add(pongWait))
 
 		var resp Response
 		if err := json.Unmarshal(data, &resp); err != nil {
@@ -320,11 +855,29 @@ func (c *Client) readLoop() {
 		switch resp.Type {
 		case "res":
 			c.reqLock.Lock()
-			if ch, ok := c.pendingReqs[resp.ID]; ok {
-				ch <- &resp
-			}
+			pending, ok := c.pendingReqs[resp.ID]
+			delete(c.pendingReqs, resp.ID)
 			c.reqLock.Unlock()
+			if ok {
+				if pending.onResponse != nil {
+					pending.onResponse(&resp)
+				}
+				pending.respCh <- &resp
+			}
 		case "event":
+			if resp.Event == "connect.challenge" {
+				select {
+				case gc.challenge <- struct{}{}:
+				default:
+				}
+				continue
+			}
+			c.connLock.Lock()
+			c.lastEvent = time.Now()
+			c.connLock.Unlock()
+			if resp.Event == "agent" {
+				c.dispatchAgentEvent(resp.Payload)
+			}
 			c.handlerLock.RLock()
 			if handler, ok := c.eventHandlers[resp.Event]; ok {
 				go handler(resp.Payload)
@@ -333,3 +886,22 @@ func (c *Client) readLoop() {
 		}
 	}
 }
+
+// keepalive 定期发送 ping, 用于发现半开连接
+func (c *Client) keepalive(gc *gatewayConn) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			deadline := time.Now().Add(10 * time.Second)
+			if err := gc.ws.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				gc.ws.Close()
+				return
+			}
+		case <-gc.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package moltbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeGateway 模拟 Gateway: 完成 connect.challenge / connect 握手,
+// 收到 agent 请求后按消息内容回放预设的运行事件
+// 事件格式: "delta:xxx" 为回复增量, "end" 正常结束, "error:xxx" 运行失败, "reject" 拒绝请求
+type fakeGateway struct {
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+	scripts  map[string][]string
+
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	connects int
+	runs     int
+}
+
+func newFakeGateway(t *testing.T, scripts map[string][]string) *fakeGateway {
+	gw := &fakeGateway{scripts: scripts}
+	gw.srv = httptest.NewServer(http.HandlerFunc(gw.serve))
+	t.Cleanup(gw.srv.Close)
+	return gw
+}
+
+// port 返回监听端口, 客户端固定连接 127.0.0.1
+func (gw *fakeGateway) port(t *testing.T) int {
+	u, err := url.Parse(gw.srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
+
+func (gw *fakeGateway) serve(w http.ResponseWriter, r *http.Request) {
+	ws, err := gw.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	gw.mu.Lock()
+	gw.conn = ws
+	gw.mu.Unlock()
+
+	ws.WriteJSON(Response{Type: "event", Event: "connect.challenge"})
+	for {
+		var req struct {
+			ID     string          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := ws.ReadJSON(&req); err != nil {
+			return
+		}
+		switch req.Method {
+		case "connect":
+			gw.mu.Lock()
+			gw.connects++
+			gw.mu.Unlock()
+			ws.WriteJSON(Response{Type: "res", ID: req.ID, OK: true})
+		case "agent":
+			var params AgentParams
+			json.Unmarshal(req.Params, &params)
+			gw.runAgent(ws, req.ID, params.Message)
+		default:
+			ws.WriteJSON(Response{Type: "res", ID: req.ID, OK: true})
+		}
+	}
+}
+
+func (gw *fakeGateway) runAgent(ws *websocket.Conn, reqID, message string) {
+	script := gw.scripts[message]
+	if len(script) > 0 && script[0] == "reject" {
+		ws.WriteJSON(Response{Type: "res", ID: reqID, OK: false, Error: &ErrorPayload{Code: "INVALID", Message: "bad request"}})
+		return
+	}
+
+	gw.mu.Lock()
+	gw.runs++
+	runID := "run-" + strconv.Itoa(gw.runs)
+	gw.mu.Unlock()
+	payload, _ := json.Marshal(AgentResponse{RunID: runID})
+	ws.WriteJSON(Response{Type: "res", ID: reqID, OK: true, Payload: payload})
+
+	// 增量紧随响应发送, 验证客户端在读循环中登记运行, 不会丢失
+	for _, step := range script {
+		var evt AgentEvent
+		switch {
+		case strings.HasPrefix(step, "delta:"):
+			data, _ := json.Marshal(AssistantDelta{Delta: strings.TrimPrefix(step, "delta:")})
+			evt = AgentEvent{RunID: runID, Stream: "assistant", Data: data}
+		case step == "end":
+			evt = AgentEvent{RunID: runID, Stream: "lifecycle", Data: json.RawMessage(`{"phase":"end"}`)}
+		case strings.HasPrefix(step, "error:"):
+			data, _ := json.Marshal(LifecycleData{Phase: "error", Error: strings.TrimPrefix(step, "error:")})
+			evt = AgentEvent{RunID: runID, Stream: "lifecycle", Data: data}
+		}
+		payload, _ := json.Marshal(evt)
+		ws.WriteJSON(Response{Type: "event", Event: "agent", Payload: payload})
+	}
+}
+
+// drop 断开当前连接, 模拟 Gateway 重启或网络中断
+func (gw *fakeGateway) drop() {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	if gw.conn != nil {
+		gw.conn.Close()
+	}
+}
+
+func (gw *fakeGateway) connectCount() int {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return gw.connects
+}
+
+func connectClient(t *testing.T, gw *fakeGateway) *Client {
+	t.Helper()
+	c := NewClient(gw.port(t), "token", "main")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// collect 读取运行的全部增量, 返回拼接的回复和结束时的错误
+func collect(t *testing.T, deltaCh <-chan string, errCh <-chan error) (string, error) {
+	t.Helper()
+	var sb strings.Builder
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case delta, ok := <-deltaCh:
+			if !ok {
+				return sb.String(), nil
+			}
+			sb.WriteString(delta)
+		case err := <-errCh:
+			return sb.String(), err
+		case <-timeout:
+			t.Fatal("timeout waiting for run to finish")
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSendMessageForwarding(t *testing.T) {
+	gw := newFakeGateway(t, map[string][]string{
+		"ok":       {"delta:你好", "delta:, ", "delta:世界", "end"},
+		"empty":    {"end"},
+		"fail":     {"delta:部分", "error:boom"},
+		"fail-msg": {"error:"},
+		"reject":   {"reject"},
+	})
+	c := connectClient(t, gw)
+
+	tests := []struct {
+		message string
+		want    string
+		wantErr string // 运行失败时的错误
+		sendErr string // SendMessage 失败时的错误
+	}{
+		{message: "ok", want: "你好, 世界"},
+		{message: "empty", want: ""},
+		{message: "fail", want: "部分", wantErr: "agent 运行失败: boom"},
+		{message: "fail-msg", wantErr: "agent 运行失败: 未知错误"},
+		{message: "reject", sendErr: "agent 请求失败: bad request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			runID, deltaCh, errCh, err := c.SendMessage(context.Background(), AgentParams{Message: tt.message, SessionKey: "s"})
+			if tt.sendErr != "" {
+				if err == nil || err.Error() != tt.sendErr {
+					t.Fatalf("SendMessage error = %v, want %q", err, tt.sendErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SendMessage: %v", err)
+			}
+			if runID == "" {
+				t.Error("empty runID")
+			}
+
+			got, err := collect(t, deltaCh, errCh)
+			if got != tt.want {
+				t.Errorf("reply = %q, want %q", got, tt.want)
+			}
+			if (err == nil) != (tt.wantErr == "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("run error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	if n := c.ActiveRuns(); n != 0 {
+		t.Errorf("ActiveRuns = %d, want 0", n)
+	}
+}
+
+func TestConcurrentRuns(t *testing.T) {
+	scripts := make(map[string][]string)
+	for i := 0; i < 8; i++ {
+		msg := "m" + strconv.Itoa(i)
+		scripts[msg] = []string{"delta:" + msg + "-a", "delta:" + msg + "-b", "end"}
+	}
+	gw := newFakeGateway(t, scripts)
+	c := connectClient(t, gw)
+
+	// 每个运行的增量只发给自己的调用方, 不按顺序读取也不会互相阻塞
+	type result struct{ msg, reply string }
+	results := make(chan result, len(scripts))
+	var wg sync.WaitGroup
+	for msg := range scripts {
+		wg.Add(1)
+		go func(msg string) {
+			defer wg.Done()
+			_, deltaCh, errCh, err := c.SendMessage(context.Background(), AgentParams{Message: msg, SessionKey: msg})
+			if err != nil {
+				t.Errorf("SendMessage(%s): %v", msg, err)
+				return
+			}
+			reply, err := collect(t, deltaCh, errCh)
+			if err != nil {
+				t.Errorf("run %s: %v", msg, err)
+			}
+			results <- result{msg, reply}
+		}(msg)
+	}
+	wg.Wait()
+	close(results)
+
+	for r := range results {
+		if want := r.msg + "-a" + r.msg + "-b"; r.reply != want {
+			t.Errorf("reply for %s = %q, want %q", r.msg, r.reply, want)
+		}
+	}
+}
+
+func TestSendMessageCanceled(t *testing.T) {
+	gw := newFakeGateway(t, map[string][]string{"hang": {"delta:思考中"}})
+	c := connectClient(t, gw)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, deltaCh, errCh, err := c.SendMessage(ctx, AgentParams{Message: "hang", SessionKey: "s"})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	if delta := <-deltaCh; delta != "思考中" {
+		t.Fatalf("delta = %q", delta)
+	}
+
+	// 调用方放弃后运行被移除, 错误通道收到取消原因
+	cancel()
+	if _, err := collect(t, deltaCh, errCh); !errors.Is(err, context.Canceled) {
+		t.Errorf("run error = %v, want context.Canceled", err)
+	}
+	waitFor(t, "run removed", func() bool { return c.ActiveRuns() == 0 })
+}
+
+func TestReconnect(t *testing.T) {
+	gw := newFakeGateway(t, map[string][]string{
+		"hang": nil,
+		"ok":   {"delta:恢复", "end"},
+	})
+	c := connectClient(t, gw)
+
+	_, deltaCh, errCh, err := c.SendMessage(context.Background(), AgentParams{Message: "hang", SessionKey: "s"})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	// 断线时进行中的运行失败, 客户端退避后重新握手
+	gw.drop()
+	if _, err := collect(t, deltaCh, errCh); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("run error = %v, want ErrDisconnected", err)
+	}
+	waitFor(t, "disconnected", func() bool { return !c.Connected() })
+
+	// 重连期间发起的请求等待连接恢复后发送
+	_, deltaCh, errCh, err = c.SendMessage(context.Background(), AgentParams{Message: "ok", SessionKey: "s"})
+	if err != nil {
+		t.Fatalf("SendMessage after reconnect: %v", err)
+	}
+	if reply, err := collect(t, deltaCh, errCh); reply != "恢复" || err != nil {
+		t.Errorf("reply = %q, %v; want %q", reply, err, "恢复")
+	}
+
+	if !c.Connected() {
+		t.Error("not connected after reconnect")
+	}
+	if n := c.Reconnects(); n != 1 {
+		t.Errorf("Reconnects = %d, want 1", n)
+	}
+	if n := gw.connectCount(); n != 2 {
+		t.Errorf("connect handshakes = %d, want 2", n)
+	}
+}
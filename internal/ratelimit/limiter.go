@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// 超限原因
+const (
+	ReasonRate  = "rate"  // 令牌桶已空, 发送过于频繁
+	ReasonQuota = "quota" // 当日配额已用完
+)
+
+// dayLayout 每日配额按本地日期计数
+const dayLayout = "2006-01-02"
+
+// Rule 限流规则, 各项为 0 表示不限制
+type Rule struct {
+	// PerMinute 每分钟补充的令牌数, Burst 为桶容量 (为 0 时取 PerMinute)
+	PerMinute float64
+	Burst     int
+	// DailyQuota 每日消息数上限
+	DailyQuota int
+}
+
+// enabled 判断规则是否有任何限制
+func (r Rule) enabled() bool {
+	return r.PerMinute > 0 || r.DailyQuota > 0
+}
+
+func (r Rule) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return r.PerMinute
+}
+
+// Check 需要检查的限流键及其规则
+type Check struct {
+	Key  string
+	Rule Rule
+}
+
+// Decision 限流结果, 未通过时 RetryAt 为可以再次发送的时间
+type Decision struct {
+	Allowed bool
+	Key     string // 未通过时为超限的键
+	Reason  string
+	RetryAt time.Time
+}
+
+// Limiter 令牌桶限流和每日配额
+type Limiter struct {
+	store Store
+	mu    sync.Mutex
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+// Close 关闭计数存储, 持久化存储会写入尚未保存的计数
+func (l *Limiter) Close() error {
+	return l.store.Close()
+}
+
+// Allow 检查所有限流键, 全部通过时才各消耗一次额度, 否则不消耗任何额度
+// 多个键超限时返回最晚的重试时间; 存储读写失败时放行
+func (l *Limiter) Allow(now time.Time, checks ...Check) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counters := make([]Counter, len(checks))
+	denied := Decision{Allowed: true}
+	for i, check := range checks {
+		if !check.Rule.enabled() {
+			continue
+		}
+		c, ok, err := l.store.Get(check.Key)
+		if err != nil {
+			slog.Warn("读取限流计数失败", "key", check.Key, "error", err)
+		}
+		counters[i] = refill(c, ok, check.Rule, now)
+
+		if reason, retryAt := exceeded(counters[i], check.Rule, now); reason != "" {
+			if denied.Allowed || retryAt.After(denied.RetryAt) {
+				denied = Decision{Key: check.Key, Reason: reason, RetryAt: retryAt}
+			}
+		}
+	}
+	if !denied.Allowed {
+		return denied
+	}
+
+	for i, check := range checks {
+		if !check.Rule.enabled() {
+			continue
+		}
+		c := counters[i]
+		if check.Rule.PerMinute > 0 {
+			c.Tokens--
+			c.FullAt = now.Add(time.Duration((check.Rule.burst() - c.Tokens) / check.Rule.PerMinute * float64(time.Minute)))
+		}
+		c.Used++
+		if err := l.store.Put(check.Key, c); err != nil {
+			slog.Warn("保存限流计数失败", "key", check.Key, "error", err)
+		}
+	}
+	return Decision{Allowed: true}
+}
+
+// refill 按经过的时间补充令牌, 跨日时重置配额计数
+func refill(c Counter, ok bool, rule Rule, now time.Time) Counter {
+	burst := rule.burst()
+	if !ok {
+		c.Tokens = burst
+	} else if elapsed := now.Sub(c.Updated); elapsed > 0 {
+		c.Tokens += elapsed.Minutes() * rule.PerMinute
+	}
+	if c.Tokens > burst {
+		c.Tokens = burst
+	}
+	c.Updated = now
+
+	if day := now.Format(dayLayout); c.Day != day {
+		c.Day, c.Used = day, 0
+	}
+	return c
+}
+
+// exceeded 判断计数是否超限, 返回原因和可以再次发送的时间
+func exceeded(c Counter, rule Rule, now time.Time) (string, time.Time) {
+	if rule.DailyQuota > 0 && c.Used >= rule.DailyQuota {
+		y, m, d := now.Date()
+		return ReasonQuota, time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	}
+	if rule.PerMinute > 0 && c.Tokens < 1 {
+		wait := time.Duration((1 - c.Tokens) / rule.PerMinute * float64(time.Minute))
+		return ReasonRate, now.Add(wait)
+	}
+	return "", time.Time{}
+}
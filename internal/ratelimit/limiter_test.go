@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	start := time.Date(2026, 1, 2, 23, 59, 0, 0, time.Local)
+	rate := Rule{PerMinute: 6, Burst: 2}
+	quota := Rule{DailyQuota: 2}
+
+	type step struct {
+		after  time.Duration // 距 start 的时间
+		checks []Check
+		want   bool
+		reason string
+		key    string
+		retry  time.Duration // 超限时距该次调用的重试等待时间
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst then refill",
+			steps: []step{
+				{0, []Check{{"u", rate}}, true, "", "", 0},
+				{0, []Check{{"u", rate}}, true, "", "", 0},
+				{0, []Check{{"u", rate}}, false, ReasonRate, "u", 10 * time.Second},
+				{5 * time.Second, []Check{{"u", rate}}, false, ReasonRate, "u", 5 * time.Second},
+				{10 * time.Second, []Check{{"u", rate}}, true, "", "", 0},
+			},
+		},
+		{
+			name: "daily quota resets next day",
+			steps: []step{
+				{0, []Check{{"u", quota}}, true, "", "", 0},
+				{0, []Check{{"u", quota}}, true, "", "", 0},
+				{30 * time.Second, []Check{{"u", quota}}, false, ReasonQuota, "u", 30 * time.Second},
+				{time.Minute, []Check{{"u", quota}}, true, "", "", 0},
+			},
+		},
+		{
+			name: "denied check consumes nothing",
+			steps: []step{
+				{0, []Check{{"u", quota}}, true, "", "", 0},
+				{0, []Check{{"u", quota}}, true, "", "", 0},
+				// u 已用完, c 不应被消耗
+				{0, []Check{{"c", Rule{DailyQuota: 1}}, {"u", quota}}, false, ReasonQuota, "u", time.Minute},
+				{0, []Check{{"c", Rule{DailyQuota: 1}}}, true, "", "", 0},
+				{0, []Check{{"c", Rule{DailyQuota: 1}}}, false, ReasonQuota, "c", time.Minute},
+			},
+		},
+		{
+			name: "latest retry wins",
+			steps: []step{
+				{0, []Check{{"u", rate}, {"c", quota}}, true, "", "", 0},
+				{0, []Check{{"u", rate}, {"c", quota}}, true, "", "", 0},
+				{0, []Check{{"u", rate}, {"c", quota}}, false, ReasonQuota, "c", time.Minute},
+			},
+		},
+		{
+			name: "disabled rule never limits",
+			steps: []step{
+				{0, []Check{{"u", Rule{}}}, true, "", "", 0},
+				{0, []Check{{"u", Rule{}}}, true, "", "", 0},
+				{0, []Check{{"u", Rule{}}}, true, "", "", 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(NewMemoryStore())
+			for i, s := range tt.steps {
+				now := start.Add(s.after)
+				d := l.Allow(now, s.checks...)
+				if d.Allowed != s.want || d.Reason != s.reason || d.Key != s.key {
+					t.Fatalf("step %d: got %+v, want allowed=%v reason=%q key=%q", i, d, s.want, s.reason, s.key)
+				}
+				if !d.Allowed {
+					if got := d.RetryAt.Sub(now).Round(time.Second); got != s.retry {
+						t.Errorf("step %d: retry after %v, want %v", i, got, s.retry)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFileStorePrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counters.json")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1).Format(dayLayout)
+	store.Put("stale", Counter{Day: yesterday, FullAt: now.Add(-time.Minute)})
+	store.Put("refilling", Counter{Day: yesterday, FullAt: now.Add(time.Hour)})
+	store.Put("today", Counter{Day: now.Format(dayLayout), Used: 1})
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	for key, want := range map[string]bool{"stale": false, "refilling": true, "today": true} {
+		if _, ok, _ := reopened.Get(key); ok != want {
+			t.Errorf("Get(%q) ok = %v, want %v", key, ok, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Counter 一个限流键的计数状态
+type Counter struct {
+	// 令牌桶: 剩余令牌数及上次补充时间
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+
+	// 每日配额: 计数所属日期 (本地时间 2006-01-02) 及当日已用次数
+	Day  string `json:"day,omitempty"`
+	Used int    `json:"used,omitempty"`
+
+	// FullAt 令牌桶重新装满的时间, 不限频率时为零值
+	FullAt time.Time `json:"full_at,omitempty"`
+}
+
+// expired 判断计数是否可以删除: 已跨日且令牌桶已装满, 与不存在的计数等价
+func (c Counter) expired(now time.Time) bool {
+	return c.Day != now.Format(dayLayout) && !now.Before(c.FullAt)
+}
+
+// Store 计数存储, 实现持久化存储可使计数在重启后保留
+type Store interface {
+	// Get 读取计数, 不存在时 ok 为 false
+	Get(key string) (c Counter, ok bool, err error)
+	// Put 保存计数
+	Put(key string, c Counter) error
+	// Close 保存尚未写入的计数并释放资源
+	Close() error
+}
+
+// pruneInterval 清理过期计数的间隔, flushInterval 计数文件的写入间隔
+const (
+	pruneInterval = time.Hour
+	flushInterval = 10 * time.Second
+)
+
+// prune 删除过期计数
+func prune(counters map[string]Counter, now time.Time) {
+	for key, c := range counters {
+		if c.expired(now) {
+			delete(counters, key)
+		}
+	}
+}
+
+// MemoryStore 内存存储, 重启后计数清零
+type MemoryStore struct {
+	counters map[string]Counter
+	pruned   time.Time
+	mu       sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]Counter), pruned: time.Now()}
+}
+
+func (s *MemoryStore) Get(key string) (Counter, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[key]
+	return c, ok, nil
+}
+
+func (s *MemoryStore) Put(key string, c Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[key] = c
+	if now := time.Now(); now.Sub(s.pruned) >= pruneInterval {
+		prune(s.counters, now)
+		s.pruned = now
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// FileStore 以 JSON 文件保存计数
+// 更新只修改内存, 由后台定时写入文件, 关闭时写入剩余更新; 写入前删除过期计数
+type FileStore struct {
+	path     string
+	counters map[string]Counter
+	dirty    bool
+	mu       sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenFileStore 打开计数文件, 文件不存在时从空计数开始
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:     path,
+		counters: make(map[string]Counter),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.counters); err != nil {
+			return nil, fmt.Errorf("解析计数文件失败: %w", err)
+		}
+		prune(s.counters, time.Now())
+	}
+	go s.flushLoop()
+	return s, nil
+}
+
+func (s *FileStore) Get(key string) (Counter, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[key]
+	return c, ok, nil
+}
+
+func (s *FileStore) Put(key string, c Counter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[key] = c
+	s.dirty = true
+	return nil
+}
+
+// Close 停止定时写入并写入剩余更新
+func (s *FileStore) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	return s.Flush()
+}
+
+func (s *FileStore) flushLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				slog.Warn("保存限流计数失败", "path", s.path, "error", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Flush 删除过期计数并在有更新时写入文件
+func (s *FileStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	prune(s.counters, time.Now())
+	if err := s.save(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// save 先写入临时文件再重命名, 避免写入中途退出导致文件损坏
+func (s *FileStore) save() error {
+	data, err := json.Marshal(s.counters)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 追踪导出方式
+const (
+	ExporterNone   = "none"   // 不导出, 不产生追踪数据
+	ExporterOTLP   = "otlp"   // 通过 OTLP/HTTP 导出到采集器
+	ExporterStdout = "stdout" // 输出到标准输出, 用于本地调试
+)
+
+const serviceName = "moltbot-feishu"
+
+// Options 追踪配置
+type Options struct {
+	Exporter string
+	// Endpoint 为 OTLP/HTTP 采集器地址, 如 http://127.0.0.1:4318
+	// 为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 等标准环境变量
+	Endpoint string
+	Version  string
+}
+
+// Setup 初始化全局 TracerProvider, 返回的 shutdown 在退出前调用以导出剩余的 span
+// 导出方式为 none 时不做任何设置, 各处创建的 span 均为空操作
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var httpOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			httpOpts = append(httpOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, httpOpts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("追踪导出方式 %q 无效，可选值: none、otlp、stdout", opts.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("创建追踪导出器失败: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", opts.Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("创建追踪资源失败: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Tracer 返回指定组件的 Tracer, 在 Setup 之前获取的 Tracer 同样会使用之后设置的 TracerProvider
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer("github.com/vogo/moltbot-feishu/internal/" + name)
+}
+
+// End 结束 span, err 不为空时记录错误并标记失败
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -4,7 +4,8 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,6 +13,9 @@ import (
 
 	"github.com/vogo/moltbot-feishu/internal/bridge"
 	"github.com/vogo/moltbot-feishu/internal/config"
+	"github.com/vogo/moltbot-feishu/internal/logging"
+	"github.com/vogo/moltbot-feishu/internal/metrics"
+	"github.com/vogo/moltbot-feishu/internal/tracing"
 )
 
 // Version 由构建时注入
@@ -28,17 +32,45 @@ func main() {
 		os.Exit(0)
 	}
 
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	log.Printf("Moltbot-Feishu 桥接服务启动中... (版本: %s)", Version)
-
 	// 加载配置
 	cfg, err := config.Load(flags)
 	if err != nil {
-		log.Fatalf("加载配置失败: %v", err)
+		slog.Error("加载配置失败", "error", err)
+		os.Exit(1)
+	}
+
+	// 初始化日志
+	if err := logging.Setup(os.Stderr, logging.Options{
+		Level:  cfg.LogLevel,
+		Format: cfg.LogFormat,
+		Redact: cfg.LogRedact,
+	}); err != nil {
+		slog.Error("初始化日志失败", "error", err)
+		os.Exit(1)
+	}
+
+	// 初始化链路追踪, 退出前导出剩余的 span
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter: cfg.TraceExporter,
+		Endpoint: cfg.TraceEndpoint,
+		Version:  Version,
+	})
+	if err != nil {
+		slog.Error("初始化链路追踪失败", "error", err)
+		os.Exit(1)
+	}
+	// os.Exit 不会执行 defer, 异常退出前需显式调用
+	flushTracing := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("导出追踪数据失败", "error", err)
+		}
 	}
+	defer flushTracing()
 
-	log.Printf("配置加载完成: AppID=%s, AgentID=%s, GatewayPort=%d",
-		maskSecret(cfg.FeishuAppID), cfg.MoltbotAgentID, cfg.GatewayPort)
+	slog.Info("Moltbot-Feishu 桥接服务启动", "version", Version,
+		"app_id", logging.MaskSecret(cfg.FeishuAppID), "agent_id", cfg.MoltbotAgentID, "gateway_port", cfg.GatewayPort)
 
 	// 创建上下文
 	ctx, cancel := context.WithCancel(context.Background())
@@ -49,29 +81,54 @@ func main() {
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		sig := <-sigCh
-		log.Printf("收到信号 %v，正在退出...", sig)
+		slog.Info("收到信号, 正在退出", "signal", sig.String())
 		cancel()
 
 		// 强制退出: 3秒后如果还未退出则强制终止
 		time.Sleep(3 * time.Second)
-		log.Println("强制退出")
+		slog.Warn("强制退出")
 		os.Exit(1)
 	}()
 
 	// 创建并运行桥接
-	b := bridge.New(cfg)
+	b, err := bridge.New(cfg)
+	if err != nil {
+		slog.Error("创建桥接失败", "error", err)
+		os.Exit(1)
+	}
+
+	// 启动健康检查、指标和事件回调接口
+	if cfg.HTTPAddr != "" {
+		srv := serveHTTP(cfg.HTTPAddr, b)
+		defer srv.Close()
+	}
+
 	if err := b.Run(ctx); err != nil {
 		if ctx.Err() == nil {
-			log.Fatalf("桥接运行失败: %v", err)
+			slog.Error("桥接运行失败", "error", err)
+			flushTracing()
+			os.Exit(1)
 		}
 	}
 
-	log.Println("服务已停止")
+	slog.Info("服务已停止")
 }
 
-func maskSecret(s string) string {
-	if len(s) <= 4 {
-		return "****"
-	}
-	return s[:4] + "****"
+// serveHTTP 在后台启动 HTTP 服务, 提供 /healthz、/livez、/readyz、/metrics 接口
+// 以及 Webhook 模式下的飞书事件回调接口
+func serveHTTP(addr string, b *bridge.Bridge) *http.Server {
+	mux := http.NewServeMux()
+	b.RegisterHealthHandlers(mux)
+	b.RegisterEventHandler(mux)
+	mux.Handle("/metrics", metrics.Handler())
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		slog.Info("HTTP 服务监听", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("HTTP 服务启动失败", "error", err)
+			os.Exit(1)
+		}
+	}()
+	return srv
 }